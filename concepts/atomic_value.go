@@ -0,0 +1,81 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Config is read constantly and replaced rarely. It is never modified in
+// place; a writer builds a new Config and swaps the pointer.
+type Config struct {
+    Version    int
+    Endpoint   string
+    MaxRetries int
+}
+
+var currentConfig atomic.Value // holds a *Config
+
+// LoadConfig returns the current config without taking a lock.
+func LoadConfig() *Config {
+    return currentConfig.Load().(*Config)
+}
+
+// StoreConfig publishes cfg to every future LoadConfig call.
+func StoreConfig(cfg *Config) {
+    currentConfig.Store(cfg)
+}
+
+// configForVersion derives every field from the version, so a reader can
+// tell whether the fields it sees all came from the same Config.
+func configForVersion(version int) *Config {
+    return &Config{
+        Version:    version,
+        Endpoint:   fmt.Sprintf("https://api-v%d.example.com", version),
+        MaxRetries: version % 5,
+    }
+}
+
+func main() {
+    StoreConfig(configForVersion(0))
+
+    var wg sync.WaitGroup
+    var reads, torn int64
+    stop := make(chan struct{})
+
+    // Many readers, no locks
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-stop:
+                    return
+                default:
+                }
+                cfg := LoadConfig()
+                if *cfg != *configForVersion(cfg.Version) {
+                    atomic.AddInt64(&torn, 1)
+                }
+                atomic.AddInt64(&reads, 1)
+            }
+        }()
+    }
+
+    // One writer periodically reloads the config
+    for version := 1; version <= 20; version++ {
+        time.Sleep(5 * time.Millisecond)
+        StoreConfig(configForVersion(version))
+    }
+    close(stop)
+    wg.Wait()
+
+    fmt.Println("Final config:", *LoadConfig())
+    fmt.Println("Reads:", reads, "torn reads:", torn)
+    if torn != 0 {
+        log.Fatalf("%d of %d reads saw a torn config", torn, reads)
+    }
+}
@@ -2,10 +2,83 @@ package main
 
 import (
     "fmt"
+    "log"
+    "runtime"
     "sync"
     "sync/atomic"
 )
 
+// cacheLineSize is the common size on x86-64 and most ARM cores.
+const cacheLineSize = 64
+
+// paddedCounter fills a whole cache line, so neighbouring counters in a
+// slice never share one.
+type paddedCounter struct {
+    value int64
+    _     [cacheLineSize - 8]byte
+}
+
+// ShardedCounter spreads one logical count over several atomic counters.
+// Each goroutine increments its own shard, so they don't all fight over the
+// same memory; the price is that Sum has to visit every shard.
+type ShardedCounter struct {
+    shards []paddedCounter
+}
+
+func NewShardedCounter(shards int) *ShardedCounter {
+    return &ShardedCounter{shards: make([]paddedCounter, shards)}
+}
+
+// Add adds delta to the given shard; callers pick a shard per goroutine.
+func (c *ShardedCounter) Add(shard int, delta int64) {
+    atomic.AddInt64(&c.shards[shard%len(c.shards)].value, delta)
+}
+
+// Sum adds up every shard. Increments racing with Sum may or may not be
+// included, but once all writers are done it is exact.
+func (c *ShardedCounter) Sum() int64 {
+    var sum int64
+    for i := range c.shards {
+        sum += atomic.LoadInt64(&c.shards[i].value)
+    }
+    return sum
+}
+
+// compareCounters runs the same high-contention workload on a single atomic
+// counter, on unpadded shards that share cache lines, and on padded shards.
+// Unpadded shards only remove the logical contention: cores still bounce
+// the shared line between them (false sharing), which padding avoids.
+func compareCounters(numGoroutines, n int) {
+    var single int64
+    unpadded := make([]int64, numGoroutines)
+    padded := NewShardedCounter(numGoroutines)
+
+    // nsPerIncrement has each goroutine call increment(id) n times
+    nsPerIncrement := func(increment func(id int)) float64 {
+        elapsed := timeGoroutines(numGoroutines, func(id int) {
+            for j := 0; j < n; j++ {
+                increment(id)
+            }
+        })
+        return float64(elapsed.Nanoseconds()) / float64(numGoroutines*n)
+    }
+    singleNs := nsPerIncrement(func(int) { atomic.AddInt64(&single, 1) })
+    unpaddedNs := nsPerIncrement(func(id int) { atomic.AddInt64(&unpadded[id], 1) })
+    paddedNs := nsPerIncrement(func(id int) { padded.Add(id, 1) })
+
+    var unpaddedSum int64
+    for i := range unpadded {
+        unpaddedSum += unpadded[i]
+    }
+    want := int64(numGoroutines * n)
+    correct := single == want && unpaddedSum == want && padded.Sum() == want
+    fmt.Printf("%3d goroutines: single %5.1f ns/op, unpadded shards %5.1f ns/op, padded shards %5.1f ns/op, sums correct: %v\n",
+        numGoroutines, singleNs, unpaddedNs, paddedNs, correct)
+    if !correct {
+        log.Fatalf("counter sums wrong with %d goroutines: want %d", numGoroutines, want)
+    }
+}
+
 func main() {
     var counter int64
     var wg sync.WaitGroup
@@ -24,4 +97,30 @@ func main() {
 
     wg.Wait()
     fmt.Println("Final Counter:", counter)
+    if counter != int64(numGoroutines*incrementsPerGoroutine) {
+        log.Fatalf("counter is %d, want %d", counter, numGoroutines*incrementsPerGoroutine)
+    }
+
+    // The same total spread over one shard per goroutine
+    sharded := NewShardedCounter(numGoroutines)
+    wg.Add(numGoroutines)
+    for i := 0; i < numGoroutines; i++ {
+        go func(shard int) {
+            defer wg.Done()
+            for j := 0; j < incrementsPerGoroutine; j++ {
+                sharded.Add(shard, 1)
+            }
+        }(i)
+    }
+    wg.Wait()
+    fmt.Println("Sharded Counter:", sharded.Sum())
+    if sharded.Sum() != int64(numGoroutines*incrementsPerGoroutine) {
+        log.Fatalf("sharded counter is %d, want %d", sharded.Sum(), numGoroutines*incrementsPerGoroutine)
+    }
+
+    // False sharing only shows up with goroutines on separate cores
+    procs := runtime.GOMAXPROCS(0)
+    for _, goroutines := range []int{procs, 2 * procs} {
+        compareCounters(goroutines, 1000000)
+    }
 }
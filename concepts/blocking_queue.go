@@ -0,0 +1,105 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+// BlockingQueue is a bounded FIFO queue. Put waits while the queue is full
+// and Take waits while it is empty, each sleeping on a condition variable
+// that the other side signals.
+type BlockingQueue struct {
+    items    []int
+    capacity int
+    maxLen   int // longest the queue has been, for demonstration
+    mu       sync.Mutex
+    notFull  *sync.Cond
+    notEmpty *sync.Cond
+}
+
+func NewBlockingQueue(capacity int) *BlockingQueue {
+    q := &BlockingQueue{capacity: capacity}
+    q.notFull = sync.NewCond(&q.mu)
+    q.notEmpty = sync.NewCond(&q.mu)
+    return q
+}
+
+func (q *BlockingQueue) Put(v int) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    // Wait in a loop: another producer may have refilled the slot between
+    // the signal and this goroutine reacquiring the mutex
+    for len(q.items) == q.capacity {
+        q.notFull.Wait()
+    }
+    q.items = append(q.items, v)
+    if len(q.items) > q.maxLen {
+        q.maxLen = len(q.items)
+    }
+    q.notEmpty.Signal()
+}
+
+func (q *BlockingQueue) Take() int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    for len(q.items) == 0 {
+        q.notEmpty.Wait()
+    }
+    v := q.items[0]
+    q.items = q.items[1:]
+    q.notFull.Signal()
+    return v
+}
+
+func main() {
+    const producers, consumers, perProducer = 4, 2, 50
+    q := NewBlockingQueue(5)
+
+    var producerWG, consumerWG sync.WaitGroup
+    producerWG.Add(producers)
+    for p := 0; p < producers; p++ {
+        go func(p int) {
+            defer producerWG.Done()
+            for i := 0; i < perProducer; i++ {
+                q.Put(p*perProducer + i)
+            }
+        }(p)
+    }
+
+    // Consumers are slower than producers, so Put spends most of its time blocked
+    seen := make([]int, producers*perProducer)
+    var seenMu sync.Mutex
+    consumerWG.Add(consumers)
+    for c := 0; c < consumers; c++ {
+        go func() {
+            defer consumerWG.Done()
+            for i := 0; i < producers*perProducer/consumers; i++ {
+                v := q.Take()
+                seenMu.Lock()
+                seen[v]++
+                seenMu.Unlock()
+                time.Sleep(100 * time.Microsecond)
+            }
+        }()
+    }
+    producerWG.Wait()
+    consumerWG.Wait()
+
+    lost, duplicated := 0, 0
+    for _, count := range seen {
+        if count == 0 {
+            lost++
+        } else if count > 1 {
+            duplicated++
+        }
+    }
+    fmt.Println("Items lost:", lost, "duplicated:", duplicated)
+    fmt.Println("Longest queue length:", q.maxLen, "capacity:", q.capacity)
+    if lost != 0 || duplicated != 0 || q.maxLen > q.capacity {
+        log.Fatalf("queue lost %d items, duplicated %d and grew to %d of %d", lost, duplicated, q.maxLen, q.capacity)
+    }
+}
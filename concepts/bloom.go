@@ -0,0 +1,70 @@
+package main
+
+// bloom.go has no main of its own; it is used by the hash index. Run them
+// together: go run hash_index.go bloom.go
+
+import (
+    "hash/fnv"
+    "math"
+    "sync/atomic"
+)
+
+// BloomFilter answers "might this key have been added?" in a fixed number
+// of bits. Each key sets k bits; a key is possibly present only if all k of
+// its bits are set. There are no false negatives, but bits set by other
+// keys can make an absent key look present. It is safe for concurrent use,
+// since bits are only ever set, with atomic ORs.
+type BloomFilter struct {
+    bits []uint64
+    m    uint64 // number of bits
+    k    int    // bits set per key
+}
+
+// NewBloomFilter sizes a filter so that once expected keys have been added,
+// an absent key looks present with probability about falsePositiveRate:
+// m = -n·ln(p)/ln(2)² bits and k = (m/n)·ln(2) hash functions.
+func NewBloomFilter(expected int, falsePositiveRate float64) *BloomFilter {
+    n := float64(expected)
+    m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+    k := int(math.Round(m / n * math.Ln2))
+    if k < 1 {
+        k = 1
+    }
+    return newBloomFilterWithSize(uint64(m), k)
+}
+
+func newBloomFilterWithSize(m uint64, k int) *BloomFilter {
+    return &BloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// positions returns the k bit positions for key. Rather than k separate
+// hash functions it uses double hashing, h1 + i·h2, from one 64-bit FNV
+// hash, which behaves about as well.
+func (f *BloomFilter) positions(key string) []uint64 {
+    h := fnv.New64a()
+    h.Write([]byte(key))
+    sum := h.Sum64()
+    h1, h2 := sum&0xffffffff, sum>>32|1 // h2 odd so the steps don't repeat early
+
+    positions := make([]uint64, f.k)
+    for i := range positions {
+        positions[i] = (h1 + uint64(i)*h2) % f.m
+    }
+    return positions
+}
+
+func (f *BloomFilter) Add(key string) {
+    for _, p := range f.positions(key) {
+        atomic.OrUint64(&f.bits[p/64], 1<<(p%64))
+    }
+}
+
+// MightContain reports false only if key was definitely never added.
+func (f *BloomFilter) MightContain(key string) bool {
+    for _, p := range f.positions(key) {
+        if atomic.LoadUint64(&f.bits[p/64])&(1<<(p%64)) == 0 {
+            return false
+        }
+    }
+    return true
+}
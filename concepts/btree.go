@@ -0,0 +1,173 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "math/rand"
+    "sort"
+)
+
+// btreeNode holds between t-1 and 2t-1 sorted keys (the root may hold
+// fewer). An internal node with n keys has n+1 children, and every key in
+// children[i] lies between keys[i-1] and keys[i].
+type btreeNode struct {
+    keys     []int
+    values   []int
+    children []*btreeNode // nil for a leaf
+}
+
+func (n *btreeNode) leaf() bool { return n.children == nil }
+
+// BTree is an in-memory B-tree of minimum degree t. In a database each node
+// would be one page of a PagedFile, so a lookup reads one page per level.
+type BTree struct {
+    root   *btreeNode
+    t      int
+    splits int // root splits so far, which is how the tree grows taller
+}
+
+func NewBTree(t int) *BTree {
+    return &BTree{root: &btreeNode{}, t: t}
+}
+
+func (b *BTree) Search(key int) (int, bool) {
+    n := b.root
+    for {
+        i := sort.SearchInts(n.keys, key)
+        if i < len(n.keys) && n.keys[i] == key {
+            return n.values[i], true
+        }
+        if n.leaf() {
+            return 0, false
+        }
+        n = n.children[i]
+    }
+}
+
+// Insert adds key, or updates its value if it is already present. Full
+// nodes are split on the way down, so there is always room to insert into
+// the leaf without walking back up.
+func (b *BTree) Insert(key, value int) {
+    if len(b.root.keys) == 2*b.t-1 {
+        b.root = &btreeNode{children: []*btreeNode{b.root}}
+        b.splitChild(b.root, 0)
+        b.splits++
+    }
+
+    n := b.root
+    for {
+        i := sort.SearchInts(n.keys, key)
+        if i < len(n.keys) && n.keys[i] == key {
+            n.values[i] = value
+            return
+        }
+        if n.leaf() {
+            n.keys = insertAt(n.keys, i, key)
+            n.values = insertAt(n.values, i, value)
+            return
+        }
+        if len(n.children[i].keys) == 2*b.t-1 {
+            b.splitChild(n, i)
+            // The median moved up to keys[i]; pick the side key belongs on
+            if key == n.keys[i] {
+                n.values[i] = value
+                return
+            }
+            if key > n.keys[i] {
+                i++
+            }
+        }
+        n = n.children[i]
+    }
+}
+
+// splitChild splits the full child parent.children[i] around its median
+// key, which moves up into parent.
+func (b *BTree) splitChild(parent *btreeNode, i int) {
+    child := parent.children[i]
+    mid := b.t - 1
+
+    right := &btreeNode{
+        keys:   append([]int(nil), child.keys[mid+1:]...),
+        values: append([]int(nil), child.values[mid+1:]...),
+    }
+    if !child.leaf() {
+        right.children = append([]*btreeNode(nil), child.children[mid+1:]...)
+        child.children = child.children[:mid+1]
+    }
+
+    parent.keys = insertAt(parent.keys, i, child.keys[mid])
+    parent.values = insertAt(parent.values, i, child.values[mid])
+    parent.children = insertAt(parent.children, i+1, right)
+    child.keys = child.keys[:mid]
+    child.values = child.values[:mid]
+}
+
+// InOrder returns every key in ascending order.
+func (b *BTree) InOrder() []int {
+    var keys []int
+    var walk func(n *btreeNode)
+    walk = func(n *btreeNode) {
+        for i, key := range n.keys {
+            if !n.leaf() {
+                walk(n.children[i])
+            }
+            keys = append(keys, key)
+        }
+        if !n.leaf() {
+            walk(n.children[len(n.keys)])
+        }
+    }
+    walk(b.root)
+    return keys
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+    s = append(s, v)
+    copy(s[i+1:], s[i:])
+    s[i] = v
+    return s
+}
+
+func main() {
+    tree := NewBTree(2) // up to 3 keys per node, so splits come quickly
+
+    rng := rand.New(rand.NewSource(1))
+    keys := rng.Perm(100)
+    for _, key := range keys {
+        tree.Insert(key, key*10)
+    }
+
+    inOrder := tree.InOrder()
+    fmt.Println("InOrder sorted:", sort.IntsAreSorted(inOrder), "- keys:", len(inOrder))
+    fmt.Println("Root splits:", tree.splits)
+    if !sort.IntsAreSorted(inOrder) || len(inOrder) != len(keys) {
+        log.Fatalf("InOrder returned %d keys out of order, want %d sorted", len(inOrder), len(keys))
+    }
+
+    missing := 0
+    for _, key := range keys {
+        if value, ok := tree.Search(key); !ok || value != key*10 {
+            missing++
+        }
+    }
+    fmt.Println("Inserted keys not found:", missing)
+    if missing != 0 {
+        log.Fatalf("%d inserted keys not found", missing)
+    }
+
+    value, ok := tree.Search(42)
+    fmt.Printf("Search 42 = %d (found: %v)\n", value, ok)
+    _, ok = tree.Search(1000)
+    fmt.Println("Search 1000 found:", ok)
+    if ok {
+        log.Fatal("found key 1000, which was never inserted")
+    }
+
+    tree.Insert(42, -1)
+    value, _ = tree.Search(42)
+    fmt.Println("After re-inserting 42:", value, "- keys:", len(tree.InOrder()))
+    if value != -1 || len(tree.InOrder()) != len(keys) {
+        log.Fatalf("re-inserting 42 left value %d and %d keys", value, len(tree.InOrder()))
+    }
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "time"
+)
+
+// sendReceive sends 0..n-1 through a channel with the given buffer size
+// from one goroutine while this one receives, and returns how many values
+// arrived, whether they arrived in order, and how long it took.
+func sendReceive(buffer, n int) (received int, inOrder bool, elapsed time.Duration) {
+    ch := make(chan int, buffer)
+    start := time.Now()
+
+    go func() {
+        for i := 0; i < n; i++ {
+            ch <- i
+        }
+        close(ch)
+    }()
+
+    inOrder = true
+    for v := range ch {
+        if v != received {
+            inOrder = false
+        }
+        received++
+    }
+    return received, inOrder, time.Since(start)
+}
+
+func main() {
+    const messages = 1000000
+
+    // Unbuffered hands each value over directly, so sender and receiver meet
+    // for every message; a buffer lets the sender run ahead
+    for _, buffer := range []int{0, 1, 10, 100, 1000} {
+        received, inOrder, elapsed := sendReceive(buffer, messages)
+        fmt.Printf("buffer %4d: %6.1f ns/message, all %d received in order: %v\n",
+            buffer, float64(elapsed.Nanoseconds())/messages, messages, received == messages && inOrder)
+        if received != messages || !inOrder {
+            log.Fatalf("buffer %d: received %d of %d messages, in order: %v", buffer, received, messages, inOrder)
+        }
+    }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "fmt"
+    "hash/fnv"
+    "log"
+    "math"
+    "math/rand"
+)
+
+// CountMinSketch estimates how often each key was seen in a fixed amount of
+// memory: depth rows of width counters. Add bumps one counter per row, and
+// Estimate takes the smallest of a key's counters. Collisions only ever add
+// to a counter, so the estimate never falls below the true count. With N
+// total counts it overshoots by more than e/width·N with probability at
+// most e^-depth. It is not safe for concurrent use.
+type CountMinSketch struct {
+    counts [][]uint64
+    width  uint64
+}
+
+func NewCountMinSketch(width, depth int) *CountMinSketch {
+    counts := make([][]uint64, depth)
+    for i := range counts {
+        counts[i] = make([]uint64, width)
+    }
+    return &CountMinSketch{counts: counts, width: uint64(width)}
+}
+
+// column returns key's counter in row i, using double hashing so each row
+// behaves like an independent hash function.
+func (s *CountMinSketch) column(key string, i int) uint64 {
+    h := fnv.New64a()
+    h.Write([]byte(key))
+    sum := h.Sum64()
+    h1, h2 := sum&0xffffffff, sum>>32|1
+    return (h1 + uint64(i)*h2) % s.width
+}
+
+func (s *CountMinSketch) Add(key string, count uint64) {
+    for i, row := range s.counts {
+        row[s.column(key, i)] += count
+    }
+}
+
+func (s *CountMinSketch) Estimate(key string) uint64 {
+    estimate := uint64(math.MaxUint64)
+    for i, row := range s.counts {
+        estimate = min(estimate, row[s.column(key, i)])
+    }
+    return estimate
+}
+
+func main() {
+    sketch := NewCountMinSketch(1000, 5)
+
+    // A skewed workload: a few keys are very popular, most are rare
+    rng := rand.New(rand.NewSource(1))
+    zipf := rand.NewZipf(rng, 1.2, 1, 9999)
+    truth := make(map[string]uint64)
+    const total = 100000
+    for i := 0; i < total; i++ {
+        key := fmt.Sprintf("key-%d", zipf.Uint64())
+        truth[key]++
+        sketch.Add(key, 1)
+    }
+
+    under, worst := 0, uint64(0)
+    for key, count := range truth {
+        estimate := sketch.Estimate(key)
+        if estimate < count {
+            under++
+        }
+        worst = max(worst, estimate-count)
+    }
+    fmt.Printf("%d distinct keys, %d underestimates, worst overestimate %d (bound e/width·N = %.0f)\n",
+        len(truth), under, worst, math.E/1000*total)
+    if under != 0 {
+        log.Fatalf("%d keys underestimated; a count-min sketch never underestimates", under)
+    }
+
+    // Heavy hitters dwarf the collision noise, so their estimates are close
+    for _, key := range []string{"key-0", "key-1", "key-2"} {
+        fmt.Printf("%s: true %d, estimate %d\n", key, truth[key], sketch.Estimate(key))
+    }
+    fmt.Println("Unseen key estimate:", sketch.Estimate("never-added"))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+    "unsafe"
+)
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+type Account struct {
+    ID      string
+    balance int
+    mu      sync.Mutex
+}
+
+func (a *Account) Balance() int {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.balance
+}
+
+// holdTime is how long a transfer holds its first lock before taking the
+// second. It widens the window so the naive version deadlocks every run
+// instead of only occasionally.
+const holdTime = 10 * time.Millisecond
+
+// moveLocked moves amount between accounts; the caller holds both locks.
+func moveLocked(from, to *Account, amount int) error {
+    if from.balance < amount {
+        return fmt.Errorf("transfer %d from %s: %w", amount, from.ID, ErrInsufficientFunds)
+    }
+    from.balance -= amount
+    to.balance += amount
+    return nil
+}
+
+// transferNaive locks the source account, then the destination. Two
+// transfers in opposite directions each take their first lock and then wait
+// forever for the one the other holds.
+func transferNaive(from, to *Account, amount int) error {
+    from.mu.Lock()
+    defer from.mu.Unlock()
+    time.Sleep(holdTime)
+    to.mu.Lock()
+    defer to.mu.Unlock()
+
+    return moveLocked(from, to, amount)
+}
+
+// transferOrdered always locks the account at the lower address first, so
+// every transfer acquires any pair of locks in the same order and no cycle
+// of waiters can form.
+func transferOrdered(from, to *Account, amount int) error {
+    first, second := from, to
+    if uintptr(unsafe.Pointer(to)) < uintptr(unsafe.Pointer(from)) {
+        first, second = to, from
+    }
+    first.mu.Lock()
+    defer first.mu.Unlock()
+    time.Sleep(holdTime)
+    second.mu.Lock()
+    defer second.mu.Unlock()
+
+    return moveLocked(from, to, amount)
+}
+
+// transferBothWays runs a→b and b→a concurrently with transfer and reports
+// whether both finished within timeout. On a deadlock the two goroutines
+// stay blocked for the rest of the program; a real fix is the ordering, not
+// the timeout.
+func transferBothWays(transfer func(from, to *Account, amount int) error, a, b *Account, timeout time.Duration) bool {
+    done := make(chan struct{})
+    go func() {
+        var wg sync.WaitGroup
+        wg.Add(2)
+        go func() { defer wg.Done(); transfer(a, b, 10) }()
+        go func() { defer wg.Done(); transfer(b, a, 20) }()
+        wg.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        return true
+    case <-time.After(timeout):
+        return false
+    }
+}
+
+func main() {
+    timeout := 500 * time.Millisecond
+
+    alice, bob := &Account{ID: "alice", balance: 100}, &Account{ID: "bob", balance: 100}
+    fmt.Println("Naive transfers completed:", transferBothWays(transferNaive, alice, bob, timeout))
+
+    carol, dave := &Account{ID: "carol", balance: 100}, &Account{ID: "dave", balance: 100}
+    completed := transferBothWays(transferOrdered, carol, dave, timeout)
+    fmt.Println("Ordered transfers completed:", completed)
+    fmt.Println("Balances after ordered transfers:", carol.Balance(), dave.Balance())
+    if !completed || carol.Balance()+dave.Balance() != 200 {
+        log.Fatalf("ordered transfers completed: %v, balances %d + %d, want 200", completed, carol.Balance(), dave.Balance())
+    }
+
+    if err := transferOrdered(carol, dave, 1000); err != nil {
+        fmt.Println("Overdraft:", err)
+    } else {
+        log.Fatal("overdraft of 1000 was allowed")
+    }
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+const numPhilosophers = 5
+
+// RunPhilosophers seats five philosophers at a round table with a fork
+// between each pair and has each of them eat rounds times, returning how
+// often each one ate. Philosopher i needs forks i and (i+1)%5. If everyone
+// picked up their left fork first, all five could hold one fork and wait
+// forever for the next. Instead each takes the lower-numbered fork first,
+// so philosopher 4 reaches for fork 0 before fork 4, and the cycle of
+// waiters can't close.
+func RunPhilosophers(rounds int) []int {
+    var forks [numPhilosophers]sync.Mutex
+    meals := make([]int, numPhilosophers)
+
+    var wg sync.WaitGroup
+    wg.Add(numPhilosophers)
+    for i := 0; i < numPhilosophers; i++ {
+        go func(id int) {
+            defer wg.Done()
+            first, second := id, (id+1)%numPhilosophers
+            if second < first {
+                first, second = second, first
+            }
+            for r := 0; r < rounds; r++ {
+                forks[first].Lock()
+                forks[second].Lock()
+                meals[id]++                  // only this philosopher writes meals[id]
+                time.Sleep(time.Millisecond) // eat
+                forks[second].Unlock()
+                forks[first].Unlock()
+                time.Sleep(time.Millisecond) // think
+            }
+        }(i)
+    }
+    wg.Wait()
+    return meals
+}
+
+func main() {
+    done := make(chan []int)
+    const rounds = 20
+    go func() { done <- RunPhilosophers(rounds) }()
+
+    select {
+    case meals := <-done:
+        fmt.Println("Meals per philosopher:", meals)
+        for id, n := range meals {
+            if n != rounds {
+                log.Fatalf("philosopher %d ate %d meals, want %d", id, n, rounds)
+            }
+        }
+    case <-time.After(5 * time.Second):
+        log.Fatal("Philosophers deadlocked")
+    }
+}
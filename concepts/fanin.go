@@ -0,0 +1,62 @@
+// Run with leakcheck.go: go run fanin.go leakcheck.go
+package main
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "sync"
+)
+
+// Merge fans every input channel into one output channel. One goroutine per
+// input forwards its values, and the output is closed only after all inputs
+// are closed.
+func Merge(chans ...<-chan int) <-chan int {
+    out := make(chan int)
+    var wg sync.WaitGroup
+
+    wg.Add(len(chans))
+    for _, c := range chans {
+        go func(c <-chan int) {
+            defer wg.Done()
+            for v := range c {
+                out <- v
+            }
+        }(c)
+    }
+
+    go func() {
+        wg.Wait()
+        close(out)
+    }()
+    return out
+}
+
+// source returns a channel that yields values and is then closed.
+func source(values ...int) <-chan int {
+    c := make(chan int)
+    go func() {
+        defer close(c)
+        for _, v := range values {
+            c <- v
+        }
+    }()
+    return c
+}
+
+func main() {
+    var received []int
+    err := checkNoLeaks(func() {
+        for v := range Merge(source(1, 2, 3), source(10, 20), source(100)) {
+            received = append(received, v)
+        }
+    })
+
+    // Arrival order depends on scheduling, so sort before printing
+    sort.Ints(received)
+    fmt.Println("Merged values:", received)
+    fmt.Println("Leak check after draining:", err)
+    if len(received) != 6 || err != nil {
+        log.Fatalf("merged %d of 6 values, leak check: %v", len(received), err)
+    }
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+// Group runs tasks in their own goroutines and collects the first error.
+// When a task fails, the group's context is cancelled so the other tasks
+// can stop early instead of finishing work nobody will use.
+type Group struct {
+    cancel  context.CancelFunc
+    wg      sync.WaitGroup
+    errOnce sync.Once
+    err     error
+}
+
+// WithContext returns a Group and the context its tasks should watch, which
+// is cancelled when a task fails or Wait returns.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+    ctx, cancel := context.WithCancel(ctx)
+    return &Group{cancel: cancel}, ctx
+}
+
+func (g *Group) Go(task func() error) {
+    g.wg.Add(1)
+    go func() {
+        defer g.wg.Done()
+        if err := task(); err != nil {
+            g.errOnce.Do(func() {
+                g.err = err
+                g.cancel()
+            })
+        }
+    }()
+}
+
+// Wait blocks until every task has returned, then returns the first error.
+func (g *Group) Wait() error {
+    g.wg.Wait()
+    g.cancel()
+    return g.err
+}
+
+// sleepTask waits for d, or returns the context's error if cancelled first.
+func sleepTask(ctx context.Context, d time.Duration) error {
+    select {
+    case <-time.After(d):
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func main() {
+    // Every task succeeds
+    g, ctx := WithContext(context.Background())
+    for i := 0; i < 3; i++ {
+        g.Go(func() error { return sleepTask(ctx, 10*time.Millisecond) })
+    }
+    err := g.Wait()
+    fmt.Println("All tasks succeed:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    // One task fails; Wait returns its error, not a sibling's cancellation
+    errFailed := errors.New("task failed")
+    g, ctx = WithContext(context.Background())
+    g.Go(func() error { return sleepTask(ctx, 10*time.Millisecond) })
+    g.Go(func() error { return errFailed })
+    err = g.Wait()
+    fmt.Println("One task fails:", err)
+    if err != errFailed {
+        log.Fatalf("Wait returned %v, want %v", err, errFailed)
+    }
+
+    // A slow task notices the failure and exits long before it would finish
+    g, ctx = WithContext(context.Background())
+    slowErr := make(chan error, 1)
+    start := time.Now()
+    g.Go(func() error {
+        err := sleepTask(ctx, 10*time.Second)
+        slowErr <- err
+        return err
+    })
+    g.Go(func() error {
+        time.Sleep(20 * time.Millisecond)
+        return errFailed
+    })
+    err = g.Wait()
+    elapsed := time.Since(start)
+    fmt.Printf("Slow task returned %v; Wait returned %v after %v\n", <-slowErr, err, elapsed.Round(10*time.Millisecond))
+    if err != errFailed || elapsed >= 10*time.Second {
+        log.Fatalf("Wait returned %v after %v, want %v once the failing task returns", err, elapsed, errFailed)
+    }
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+var ErrLogClosed = errors.New("commit log is closed")
+
+// GroupCommitConfig bounds how long commits wait to share an fsync.
+type GroupCommitConfig struct {
+    MaxBatch int           // flush as soon as this many commits are pending
+    MaxWait  time.Duration // or once the oldest pending commit has waited this long
+}
+
+type commitRequest struct {
+    txID uint64
+    done chan error
+}
+
+// CommitLog appends commit records to a file and makes them durable with
+// group commit: a single flusher goroutine gathers concurrent commits into
+// a batch, writes them together, and fsyncs once for the whole batch.
+type CommitLog struct {
+    file     *os.File
+    config   GroupCommitConfig
+    requests chan commitRequest
+    flushes  int64        // fsyncs so far, updated atomically
+    lock     sync.RWMutex // CommitWithGroup holds it shared, Close exclusively
+    closed   bool
+    wg       sync.WaitGroup
+}
+
+func NewCommitLog(path string, config GroupCommitConfig) (*CommitLog, error) {
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+    wal := &CommitLog{
+        file:     file,
+        config:   config,
+        requests: make(chan commitRequest),
+    }
+    wal.wg.Add(1)
+    go wal.flusher()
+    return wal, nil
+}
+
+// CommitWithGroup records txID's commit and returns once it is on disk,
+// possibly sharing the fsync with other transactions committing at the
+// same time.
+func (wal *CommitLog) CommitWithGroup(txID uint64) error {
+    wal.lock.RLock()
+    if wal.closed {
+        wal.lock.RUnlock()
+        return ErrLogClosed
+    }
+    req := commitRequest{txID: txID, done: make(chan error, 1)}
+    wal.requests <- req
+    wal.lock.RUnlock()
+
+    return <-req.done
+}
+
+func (wal *CommitLog) flusher() {
+    defer wal.wg.Done()
+
+    for first := range wal.requests {
+        batch := []commitRequest{first}
+        timeout := time.After(wal.config.MaxWait)
+    gather:
+        for len(batch) < wal.config.MaxBatch {
+            select {
+            case req, ok := <-wal.requests:
+                if !ok {
+                    break gather
+                }
+                batch = append(batch, req)
+            case <-timeout:
+                break gather
+            }
+        }
+
+        err := wal.flush(batch)
+        for _, req := range batch {
+            req.done <- err
+        }
+    }
+}
+
+// flush writes one 8-byte record per commit and fsyncs once. Only a
+// successful fsync counts as a flush.
+func (wal *CommitLog) flush(batch []commitRequest) error {
+    buf := make([]byte, 0, 8*len(batch))
+    for _, req := range batch {
+        buf = binary.BigEndian.AppendUint64(buf, req.txID)
+    }
+    if _, err := wal.file.Write(buf); err != nil {
+        return fmt.Errorf("write commit batch: %w", err)
+    }
+    if err := wal.file.Sync(); err != nil {
+        return fmt.Errorf("sync commit batch: %w", err)
+    }
+    atomic.AddInt64(&wal.flushes, 1)
+    return nil
+}
+
+func (wal *CommitLog) Flushes() int64 {
+    return atomic.LoadInt64(&wal.flushes)
+}
+
+// Close waits for pending commits to flush and closes the file. Closing an
+// already closed log does nothing.
+func (wal *CommitLog) Close() error {
+    wal.lock.Lock()
+    if wal.closed {
+        wal.lock.Unlock()
+        return nil
+    }
+    wal.closed = true
+    close(wal.requests)
+    wal.lock.Unlock()
+
+    wal.wg.Wait()
+    return wal.file.Close()
+}
+
+// commitConcurrently commits txIDs 1..n from n goroutines at once and
+// reports how long it took and how many fsyncs were needed.
+func commitConcurrently(path string, config GroupCommitConfig, n int) (time.Duration, int64, error) {
+    wal, err := NewCommitLog(path, config)
+    if err != nil {
+        return 0, 0, err
+    }
+    defer wal.Close()
+
+    var wg sync.WaitGroup
+    errs := make(chan error, n)
+    start := time.Now()
+    for i := 1; i <= n; i++ {
+        wg.Add(1)
+        go func(txID uint64) {
+            defer wg.Done()
+            // Returning means this commit is durable
+            if err := wal.CommitWithGroup(txID); err != nil {
+                errs <- err
+            }
+        }(uint64(i))
+    }
+    wg.Wait()
+    close(errs)
+    if err := <-errs; err != nil {
+        return 0, 0, err
+    }
+    return time.Since(start), wal.Flushes(), nil
+}
+
+func main() {
+    dir, err := os.MkdirTemp("", "group_commit")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    const commits = 20
+
+    configs := []struct {
+        name   string
+        config GroupCommitConfig
+    }{
+        {"fsync per commit", GroupCommitConfig{MaxBatch: 1, MaxWait: 0}},
+        {"group commit", GroupCommitConfig{MaxBatch: 20, MaxWait: 50 * time.Millisecond}},
+    }
+    for i, c := range configs {
+        elapsed, flushes, err := commitConcurrently(filepath.Join(dir, fmt.Sprintf("commits-%d.log", i)), c.config, commits)
+        if err != nil {
+            log.Fatalf("%s: commit failed: %v", c.name, err)
+        }
+        fmt.Printf("%s: %d commits, %d fsync(s), %v\n", c.name, commits, flushes, elapsed.Round(10*time.Microsecond))
+        if c.config.MaxBatch == 1 && flushes != commits {
+            log.Fatalf("%s: %d fsyncs for %d commits, want one each", c.name, flushes, commits)
+        }
+        if c.config.MaxBatch > 1 && flushes >= commits {
+            log.Fatalf("%s: %d fsyncs for %d commits, want fewer fsyncs than commits", c.name, flushes, commits)
+        }
+    }
+
+    wal, err := NewCommitLog(filepath.Join(dir, "close-twice.log"), configs[1].config)
+    if err != nil {
+        log.Fatal(err)
+    }
+    first, second := wal.Close(), wal.Close()
+    fmt.Println("Closing the log twice:", first, second)
+    if first != nil || second != nil {
+        log.Fatalf("closing the log twice returned %v, %v, want nil both times", first, second)
+    }
+
+    info, err := os.Stat(filepath.Join(dir, "commits-1.log"))
+    if err != nil {
+        log.Fatal(err)
+    }
+    fmt.Println("Group commit log size:", info.Size(), "bytes")
+    if info.Size() != 8*commits {
+        log.Fatalf("group commit log is %d bytes, want one 8-byte record per commit (%d)", info.Size(), 8*commits)
+    }
+}
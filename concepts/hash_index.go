@@ -0,0 +1,263 @@
+// Run with bloom.go: go run hash_index.go bloom.go
+package main
+
+import (
+    "fmt"
+    "hash/fnv"
+    "log"
+    "sync"
+    "sync/atomic"
+)
+
+type hashEntry struct {
+    key   string
+    value int
+}
+
+// hashBucket chains every entry whose key hashes to it.
+type hashBucket struct {
+    entries []hashEntry
+    mu      sync.Mutex
+}
+
+// maxLoadFactor is the average chain length at which Put doubles the
+// bucket count.
+const maxLoadFactor = 2.0
+
+// HashIndex is a hash table whose keys that collide share a bucket's chain.
+// Each bucket has its own lock, so operations on keys in different buckets
+// run in parallel. When chains grow too long on average, Put doubles the
+// number of buckets and rehashes every entry.
+type HashIndex struct {
+    buckets []hashBucket
+    hash    func(key string) uint32
+    count   int64        // entries in the index, updated atomically
+    resize  sync.RWMutex // held shared by every operation, exclusively to resize
+
+    bloom      *BloomFilter // nil unless created with NewHashIndexWithBloom
+    bloomSkips int64        // Gets answered by the filter alone, updated atomically
+}
+
+func NewHashIndex(buckets int) *HashIndex {
+    return newHashIndexWithHash(buckets, func(key string) uint32 {
+        h := fnv.New32a()
+        h.Write([]byte(key))
+        return h.Sum32()
+    })
+}
+
+// NewHashIndexWithBloom adds a bloom filter sized for expectedKeys, so Get
+// can report a definite miss without locking or searching a bucket. Deleted
+// keys stay in the filter; they only cost a bucket search, never a wrong
+// answer.
+func NewHashIndexWithBloom(buckets, expectedKeys int, falsePositiveRate float64) *HashIndex {
+    h := NewHashIndex(buckets)
+    h.bloom = NewBloomFilter(expectedKeys, falsePositiveRate)
+    return h
+}
+
+// newHashIndexWithHash lets the example force collisions with a bad hash.
+func newHashIndexWithHash(buckets int, hash func(key string) uint32) *HashIndex {
+    return &HashIndex{buckets: make([]hashBucket, buckets), hash: hash}
+}
+
+// bucket returns key's bucket; the caller must hold h.resize.
+func (h *HashIndex) bucket(key string) *hashBucket {
+    return &h.buckets[h.hash(key)%uint32(len(h.buckets))]
+}
+
+// load returns the average chain length; the caller must hold h.resize.
+func (h *HashIndex) load() float64 {
+    return float64(atomic.LoadInt64(&h.count)) / float64(len(h.buckets))
+}
+
+func (h *HashIndex) Put(key string, value int) {
+    // Into the filter first, so a Get that can see the entry never misses it
+    if h.bloom != nil {
+        h.bloom.Add(key)
+    }
+    h.resize.RLock()
+    grow := h.put(key, value)
+    h.resize.RUnlock()
+
+    if grow {
+        h.grow()
+    }
+}
+
+// put inserts or updates key and reports whether the index is now over its
+// load factor; the caller must hold h.resize shared.
+func (h *HashIndex) put(key string, value int) bool {
+    b := h.bucket(key)
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    for i := range b.entries {
+        if b.entries[i].key == key {
+            b.entries[i].value = value
+            return false
+        }
+    }
+    b.entries = append(b.entries, hashEntry{key: key, value: value})
+    atomic.AddInt64(&h.count, 1)
+    return h.load() > maxLoadFactor
+}
+
+// grow doubles the bucket count and rehashes every entry. Holding h.resize
+// exclusively waits out every operation in flight, so no bucket lock is
+// needed while entries move.
+func (h *HashIndex) grow() {
+    h.resize.Lock()
+    defer h.resize.Unlock()
+
+    // Another Put may have grown the index while this one waited for the lock
+    if h.load() <= maxLoadFactor {
+        return
+    }
+    old := h.buckets
+    h.buckets = make([]hashBucket, 2*len(old))
+    for i := range old {
+        for _, e := range old[i].entries {
+            b := h.bucket(e.key)
+            b.entries = append(b.entries, e)
+        }
+    }
+}
+
+// Buckets returns the current number of buckets.
+func (h *HashIndex) Buckets() int {
+    h.resize.RLock()
+    defer h.resize.RUnlock()
+    return len(h.buckets)
+}
+
+func (h *HashIndex) Get(key string) (int, bool) {
+    if h.bloom != nil && !h.bloom.MightContain(key) {
+        atomic.AddInt64(&h.bloomSkips, 1)
+        return 0, false
+    }
+    h.resize.RLock()
+    defer h.resize.RUnlock()
+
+    b := h.bucket(key)
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    for _, e := range b.entries {
+        if e.key == key {
+            return e.value, true
+        }
+    }
+    return 0, false
+}
+
+func (h *HashIndex) Delete(key string) {
+    h.resize.RLock()
+    defer h.resize.RUnlock()
+
+    b := h.bucket(key)
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    for i, e := range b.entries {
+        if e.key == key {
+            // Order within a chain doesn't matter, so move the last entry into the gap
+            last := len(b.entries) - 1
+            b.entries[i] = b.entries[last]
+            b.entries = b.entries[:last]
+            atomic.AddInt64(&h.count, -1)
+            return
+        }
+    }
+}
+
+func main() {
+    index := NewHashIndex(16)
+
+    // Writers and readers on many keys at once; run with -race to check the locking
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g++ {
+        wg.Add(2)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 1000; i++ {
+                index.Put(fmt.Sprintf("key-%d-%d", g, i), i)
+            }
+        }(g)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 1000; i++ {
+                index.Get(fmt.Sprintf("key-%d-%d", g, i))
+            }
+        }(g)
+    }
+    wg.Wait()
+
+    wrong := 0
+    for g := 0; g < 8; g++ {
+        for i := 0; i < 1000; i++ {
+            if value, ok := index.Get(fmt.Sprintf("key-%d-%d", g, i)); !ok || value != i {
+                wrong++
+            }
+        }
+    }
+    fmt.Println("Keys missing or wrong after concurrent puts:", wrong)
+    if wrong != 0 {
+        log.Fatalf("%d keys missing or wrong after concurrent puts", wrong)
+    }
+    fmt.Printf("Buckets grew from 16 to %d (load %.2f)\n", index.Buckets(), index.load())
+
+    // Every key collides in one bucket, yet each is still found by its own key
+    colliding := newHashIndexWithHash(16, func(string) uint32 { return 7 })
+    for i, key := range []string{"apple", "banana", "cherry"} {
+        colliding.Put(key, i)
+    }
+    colliding.Delete("banana")
+    for _, key := range []string{"apple", "banana", "cherry"} {
+        value, ok := colliding.Get(key)
+        fmt.Printf("Colliding Get(%q) = %d (found: %v)\n", key, value, ok)
+        if ok != (key != "banana") {
+            log.Fatalf("colliding Get(%q) found: %v after deleting banana", key, ok)
+        }
+    }
+    fmt.Println("Entries in bucket 7:", len(colliding.buckets[7].entries))
+
+    bloomExample()
+}
+
+func bloomExample() {
+    const n, rate = 10000, 0.01
+    index := NewHashIndexWithBloom(16, n, rate)
+    for i := 0; i < n; i++ {
+        index.Put(fmt.Sprintf("added-%d", i), i)
+    }
+
+    // Every added key must pass the filter
+    falseNegatives := 0
+    for i := 0; i < n; i++ {
+        if !index.bloom.MightContain(fmt.Sprintf("added-%d", i)) {
+            falseNegatives++
+        }
+    }
+
+    // Misses the filter lets through cost a bucket search; the rest are skipped
+    falsePositives := 0
+    for i := 0; i < n; i++ {
+        key := fmt.Sprintf("missing-%d", i)
+        if index.bloom.MightContain(key) {
+            falsePositives++
+        }
+        index.Get(key)
+    }
+    fmt.Printf("Bloom filter (%d bits, k=%d): %d false negatives, false-positive rate %.4f (configured %.2f)\n",
+        index.bloom.m, index.bloom.k, falseNegatives, float64(falsePositives)/n, rate)
+    if falseNegatives != 0 {
+        log.Fatalf("bloom filter rejected %d added keys", falseNegatives)
+    }
+    // Over 10000 probes the measured rate should land well within twice the
+    // configured one; more than that means the sizing or hashing is off
+    if measured := float64(falsePositives) / n; measured > 2*rate {
+        log.Fatalf("bloom filter false-positive rate %.4f, want at most %.2f", measured, 2*rate)
+    }
+    fmt.Printf("Gets of missing keys skipped by the filter: %d of %d\n", atomic.LoadInt64(&index.bloomSkips), n)
+}
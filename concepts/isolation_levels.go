@@ -1,115 +1,671 @@
+// Run with lost_update.go: go run isolation_levels.go lost_update.go
 package main
 
 import (
+    "context"
     "database/sql"
+    "errors"
     "fmt"
     "log"
+    "math/rand"
+    "os"
+    "path/filepath"
     "sync"
+    "sync/atomic"
+    "time"
 
-    _ "github.com/mattn/go-sqlite3"
+    "github.com/mattn/go-sqlite3"
 )
 
-func readCommittedExample(db *sql.DB, wg *sync.WaitGroup) {
-    defer wg.Done()
+const (
+    selectBalance     = "SELECT balance FROM accounts WHERE id = 1"
+    countRichAccounts = "SELECT COUNT(*) FROM accounts WHERE balance > 50"
+)
 
-    tx, err := db.Begin()
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+    QueryRow(query string, args ...any) *sql.Row
+}
+
+// openAccountsDB creates a database at path holding account 1 with balance 100.
+// A file in WAL mode is used rather than :memory:, because every pooled
+// connection to :memory: gets its own private database, so concurrent
+// transactions would never see each other.
+func openAccountsDB(path string) (*sql.DB, error) {
+    db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
     if err != nil {
-        log.Fatal(err)
+        return nil, err
     }
-    defer tx.Rollback()
 
-    var value int
-    err = tx.QueryRow("SELECT balance FROM accounts WHERE id = 1").Scan(&value)
+    _, err = db.Exec("CREATE TABLE accounts (id INTEGER PRIMARY KEY, balance INTEGER)")
     if err != nil {
-        fmt.Println("Read Committed: Error reading value:", err)
-        return
+        db.Close()
+        return nil, err
     }
-    fmt.Println("Read Committed: Initial balance =", value)
-
-    // Simulate delay
-    // time.Sleep(1 * time.Second)
 
-    err = tx.QueryRow("SELECT balance FROM accounts WHERE id = 1").Scan(&value)
+    // Insert initial data
+    _, err = db.Exec("INSERT INTO accounts (id, balance) VALUES (1, 100)")
     if err != nil {
-        fmt.Println("Read Committed: Error reading value:", err)
-        return
+        db.Close()
+        return nil, err
     }
-    fmt.Println("Read Committed: Balance after delay =", value)
+    return db, nil
+}
+
+// RunIsolationExample reads the balance of account 1 twice at the given
+// isolation level and returns both reads. If updater is non-nil it runs on
+// its own goroutine once the first read is done, and the second read waits
+// for it to finish and then for delay, so the interfering update always
+// lands between the two reads.
+//
+// SQLite ignores the requested level and runs every transaction
+// serializably, so read committed (and weaker) is modeled by issuing each
+// read as its own statement, which sees whatever was committed when it runs.
+func RunIsolationExample(db *sql.DB, level sql.IsolationLevel, delay time.Duration, updater func(db *sql.DB) error) (initial, afterDelay int, err error) {
+    return readTwice(db, level, selectBalance, delay, updater)
+}
 
-    tx.Commit()
+// RunPhantomExample counts accounts with balance > 50 twice while another
+// transaction inserts a matching row between the counts. At read committed
+// the new row shows up in the second count (a phantom read); at serializable
+// it doesn't. Returns both counts and their difference.
+func RunPhantomExample(db *sql.DB, level sql.IsolationLevel, delay time.Duration) (first, second, delta int, err error) {
+    first, second, err = readTwice(db, level, countRichAccounts, delay, insertAccount)
+    return first, second, second - first, err
 }
 
-func serializableExample(db *sql.DB, wg *sync.WaitGroup) {
-    defer wg.Done()
+// readTwice runs query twice at level with updater in between; see RunIsolationExample.
+func readTwice(db *sql.DB, level sql.IsolationLevel, query string, delay time.Duration, updater func(db *sql.DB) error) (first, second int, err error) {
+    var q querier = db
+    var tx *sql.Tx
+    if level > sql.LevelReadCommitted || level == sql.LevelDefault {
+        tx, err = db.BeginTx(context.Background(), &sql.TxOptions{Isolation: level})
+        if err != nil {
+            return 0, 0, err
+        }
+        defer tx.Rollback()
+        q = tx
+    }
+
+    if err = q.QueryRow(query).Scan(&first); err != nil {
+        return 0, 0, fmt.Errorf("first read: %w", err)
+    }
+
+    // Barrier: the updater starts only after the first read and must
+    // finish before the second
+    if updater != nil {
+        updated := make(chan error, 1)
+        go func() {
+            updated <- updater(db)
+        }()
+        if err = <-updated; err != nil {
+            return 0, 0, fmt.Errorf("updater: %w", err)
+        }
+    }
+
+    // Simulate delay
+    time.Sleep(delay)
+
+    if err = q.QueryRow(query).Scan(&second); err != nil {
+        return 0, 0, fmt.Errorf("second read: %w", err)
+    }
 
-    tx, err := db.BeginTx(nil, &sql.TxOptions{Isolation: sql.LevelSerializable})
+    if tx != nil {
+        err = tx.Commit()
+    }
+    return first, second, err
+}
+
+// updateBalance simulates another transaction changing the balance.
+func updateBalance(db *sql.DB, delta int) error {
+    tx, err := db.Begin()
     if err != nil {
-        log.Fatal(err)
+        return err
     }
     defer tx.Rollback()
 
-    var value int
-    err = tx.QueryRow("SELECT balance FROM accounts WHERE id = 1").Scan(&value)
+    _, err = tx.Exec("UPDATE accounts SET balance = balance + ? WHERE id = 1", delta)
     if err != nil {
-        fmt.Println("Serializable: Error reading value:", err)
-        return
+        return err
     }
-    fmt.Println("Serializable: Initial balance =", value)
+    return tx.Commit()
+}
 
-    // Simulate delay
-    // time.Sleep(1 * time.Second)
+// ConflictScenario describes the interfering transaction that runs between
+// the two reads: it adds Delta to the balance Updates times and then commits
+// or, if Commit is false, rolls back.
+type ConflictScenario struct {
+    Delta   int
+    Updates int
+    Commit  bool
+}
+
+func (sc ConflictScenario) String() string {
+    outcome := "rolled back"
+    if sc.Commit {
+        outcome = "committed"
+    }
+    return fmt.Sprintf("%d x %+d, %s", sc.Updates, sc.Delta, outcome)
+}
 
-    err = tx.QueryRow("SELECT balance FROM accounts WHERE id = 1").Scan(&value)
+// updater returns sc as an updater for RunIsolationExample.
+func (sc ConflictScenario) updater(db *sql.DB) error {
+    tx, err := db.Begin()
     if err != nil {
-        fmt.Println("Serializable: Error reading value:", err)
-        return
+        return err
     }
-    fmt.Println("Serializable: Balance after delay =", value)
+    defer tx.Rollback()
 
-    tx.Commit()
+    for i := 0; i < sc.Updates; i++ {
+        if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE id = 1", sc.Delta); err != nil {
+            return err
+        }
+    }
+    if !sc.Commit {
+        return tx.Rollback()
+    }
+    return tx.Commit()
 }
 
-func main() {
-    db, err := sql.Open("sqlite3", ":memory:")
-    if err != nil {
-        log.Fatal(err)
+// RunConflictScenario is RunIsolationExample with the interfering write
+// described by sc, so committed and rolled-back updates can be compared at
+// every level.
+func RunConflictScenario(db *sql.DB, level sql.IsolationLevel, delay time.Duration, sc ConflictScenario) (initial, afterDelay int, err error) {
+    return RunIsolationExample(db, level, delay, sc.updater)
+}
+
+// insertAccount simulates another transaction adding a row that matches countRichAccounts.
+func insertAccount(db *sql.DB) error {
+    _, err := db.Exec("INSERT INTO accounts (balance) VALUES (75)")
+    return err
+}
+
+// WithRetry runs fn in a serializable transaction and commits it, starting
+// over (up to maxAttempts in total) when SQLite reports a serialization
+// failure. Any other error rolls back and is returned immediately. Each
+// transaction is begun with ctx, so cancelling it rolls back the attempt in
+// flight and stops the retries; WithRetry then returns ctx.Err().
+func WithRetry(ctx context.Context, db *sql.DB, maxAttempts int, fn func(tx *sql.Tx) error) error {
+    return WithRetryMetrics(ctx, db, maxAttempts, nil, fn)
+}
+
+// RetryMetrics accumulates what WithRetryMetrics calls did. One value can be
+// shared by many concurrent calls; its counters are updated atomically.
+type RetryMetrics struct {
+    calls     int64
+    attempts  int64
+    conflicts int64 // attempts that hit a serialization failure
+    commits   int64
+}
+
+// RetryStats is a snapshot of RetryMetrics. Every attempt either commits,
+// conflicts, or fails with some other error, so Attempts - Conflicts -
+// Commits is the number of calls that gave up on a non-retryable error.
+type RetryStats struct {
+    Calls     int64
+    Attempts  int64
+    Conflicts int64
+    Commits   int64
+}
+
+func (m *RetryMetrics) Stats() RetryStats {
+    return RetryStats{
+        Calls:     atomic.LoadInt64(&m.calls),
+        Attempts:  atomic.LoadInt64(&m.attempts),
+        Conflicts: atomic.LoadInt64(&m.conflicts),
+        Commits:   atomic.LoadInt64(&m.commits),
     }
-    defer db.Close()
+}
 
-    _, err = db.Exec("CREATE TABLE accounts (id INTEGER PRIMARY KEY, balance INTEGER)")
-    if err != nil {
-        log.Fatal(err)
+// BackoffConfig spaces out retries after a conflict. Retrying at once only
+// sends the same transactions back into each other, so the delay before
+// retry n is up to BaseDelay*2^(n-1), capped at MaxDelay, and a random
+// jitter spreads the retries of transactions that conflicted together.
+type BackoffConfig struct {
+    BaseDelay time.Duration // zero retries immediately
+    MaxDelay  time.Duration
+
+    // OnBackoff, if set, is called with each retry's number and delay
+    // before sleeping, so callers can observe the schedule
+    OnBackoff func(retry int, delay time.Duration)
+}
+
+// DefaultBackoff is the schedule WithRetry and WithRetryMetrics use.
+var DefaultBackoff = BackoffConfig{BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+// delay returns how long to wait before retry n (1 for the first retry):
+// the capped exponential delay d, of which the second half is jitter, so
+// waits grow with n, never exceed the cap, and rarely repeat.
+func (b BackoffConfig) delay(n int) time.Duration {
+    if b.BaseDelay <= 0 {
+        return 0
+    }
+    d := b.MaxDelay
+    if n < 32 && b.BaseDelay<<(n-1) < b.MaxDelay {
+        d = b.BaseDelay << (n - 1)
     }
+    return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
 
-    // Insert initial data
-    _, err = db.Exec("INSERT INTO accounts (id, balance) VALUES (1, 100)")
+// wait sleeps before retry n, returning early with ctx.Err() if ctx is
+// done first.
+func (b BackoffConfig) wait(ctx context.Context, n int) error {
+    d := b.delay(n)
+    if b.OnBackoff != nil {
+        b.OnBackoff(n, d)
+    }
+    if d == 0 {
+        return ctx.Err()
+    }
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// WithRetryMetrics is WithRetry that records each attempt and conflict in
+// metrics, which may be nil.
+func WithRetryMetrics(ctx context.Context, db *sql.DB, maxAttempts int, metrics *RetryMetrics, fn func(tx *sql.Tx) error) error {
+    return WithRetryBackoff(ctx, db, maxAttempts, DefaultBackoff, metrics, fn)
+}
+
+// WithRetryBackoff is WithRetryMetrics with the wait between attempts set
+// by backoff.
+func WithRetryBackoff(ctx context.Context, db *sql.DB, maxAttempts int, backoff BackoffConfig, metrics *RetryMetrics, fn func(tx *sql.Tx) error) error {
+    if metrics == nil {
+        metrics = &RetryMetrics{} // counted and thrown away
+    }
+    atomic.AddInt64(&metrics.calls, 1)
+
+    var err error
+    for attempt := 1; attempt <= maxAttempts; attempt++ {
+        if attempt > 1 {
+            if err := backoff.wait(ctx, attempt-1); err != nil {
+                return err
+            }
+        }
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        atomic.AddInt64(&metrics.attempts, 1)
+        err = runTx(ctx, db, fn)
+        if err == nil {
+            atomic.AddInt64(&metrics.commits, 1)
+            return nil
+        }
+        // Whatever the attempt failed with, a cancelled context is the cause
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if !isRetryable(err) {
+            return err
+        }
+        atomic.AddInt64(&metrics.conflicts, 1)
+    }
+    return fmt.Errorf("giving up after %d attempts: %w", maxAttempts, err)
+}
+
+// runTx runs fn in a transaction begun with ctx. database/sql rolls the
+// transaction back as soon as ctx is done, and the deferred Rollback covers
+// every other way out.
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+    tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
     if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := fn(tx); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// ConcurrentResult sums up a RunConcurrent call. Every transaction either
+// commits, fails with a retryable busy/locked error, or fails otherwise.
+type ConcurrentResult struct {
+    Elapsed   time.Duration
+    Commits   int
+    Retryable int
+    Other     int
+}
+
+// RunConcurrent limits db's pool to maxOpenConns connections, then runs fn in
+// one serializable transaction on each of workers goroutines at once, without
+// retrying, and reports how long they took and how each one ended. With a
+// small pool, workers queue for a connection inside database/sql; with a
+// large one, they reach SQLite together and contend for its write lock.
+func RunConcurrent(db *sql.DB, maxOpenConns int, workers int, fn func(*sql.Tx) error) ConcurrentResult {
+    db.SetMaxOpenConns(maxOpenConns)
+
+    var result ConcurrentResult
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    wg.Add(workers)
+    start := time.Now()
+    for w := 0; w < workers; w++ {
+        go func() {
+            defer wg.Done()
+            err := runTx(context.Background(), db, fn)
+
+            mu.Lock()
+            defer mu.Unlock()
+            switch {
+            case err == nil:
+                result.Commits++
+            case isRetryable(err):
+                result.Retryable++
+            default:
+                result.Other++
+            }
+        }()
+    }
+    wg.Wait()
+    result.Elapsed = time.Since(start)
+    return result
+}
+
+// isRetryable reports whether err is SQLite telling us another transaction
+// got in first: SQLITE_BUSY (including BUSY_SNAPSHOT, a stale WAL snapshot
+// trying to write) or SQLITE_LOCKED.
+func isRetryable(err error) bool {
+    var sqliteErr sqlite3.Error
+    if errors.As(err, &sqliteErr) {
+        return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+    }
+    return false
+}
+
+func retryExample(db *sql.DB) {
+    attempts := 0
+    err := WithRetry(context.Background(), db, 3, func(tx *sql.Tx) error {
+        attempts++
+
+        var balance int
+        if err := tx.QueryRow(selectBalance).Scan(&balance); err != nil {
+            return err
+        }
+
+        // On the first attempt another transaction commits after our read,
+        // so our write is based on a stale snapshot and must be retried
+        if attempts == 1 {
+            if err := updateBalance(db, 50); err != nil {
+                return err
+            }
+        }
+
+        _, err := tx.Exec("UPDATE accounts SET balance = ? WHERE id = 1", balance+10)
+        return err
+    })
+
+    var balance int
+    db.QueryRow(selectBalance).Scan(&balance)
+    fmt.Printf("WithRetry: err = %v after %d attempts, balance = %d\n", err, attempts, balance)
+    if err != nil || balance != 160 {
+        log.Fatalf("WithRetry returned %v with balance %d, want the retry to commit 160", err, balance)
+    }
+}
+
+// cancelExample cancels a WithRetry call during its third attempt. The
+// first two attempts hit a simulated conflict; the third has written to the
+// row when the context is cancelled, so its write must be rolled back and
+// no fourth attempt may start.
+func cancelExample(db *sql.DB) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    var before int
+    if err := db.QueryRow(selectBalance).Scan(&before); err != nil {
         log.Fatal(err)
     }
 
+    attempts := 0
+    start := time.Now()
+    err := WithRetry(ctx, db, 10, func(tx *sql.Tx) error {
+        attempts++
+        if _, err := tx.Exec("UPDATE accounts SET balance = balance + 1 WHERE id = 1"); err != nil {
+            return err
+        }
+        if attempts == 3 {
+            cancel()
+        }
+        select {
+        case <-time.After(20 * time.Millisecond):
+        case <-ctx.Done():
+            return nil // let Commit find the transaction already rolled back
+        }
+        return sqlite3.Error{Code: sqlite3.ErrBusy}
+    })
+
+    var balance int
+    db.QueryRow(selectBalance).Scan(&balance)
+    fmt.Printf("Cancelled WithRetry: err = %v after %d attempts in %v (context error: %v), balance = %d\n",
+        err, attempts, time.Since(start).Round(10*time.Millisecond), errors.Is(err, context.Canceled), balance)
+    if !errors.Is(err, context.Canceled) {
+        log.Fatalf("cancelled WithRetry returned %v, want %v", err, context.Canceled)
+    }
+    if attempts != 3 {
+        log.Fatalf("cancelled WithRetry made %d attempts, want it to stop at the third", attempts)
+    }
+    if balance != before {
+        log.Fatalf("balance after the cancelled WithRetry = %d, want the rollback to leave %d", balance, before)
+    }
+}
+
+// backoffExample records the delays WithRetryBackoff waits between attempts
+// that always conflict, twice, to show them doubling up to the cap and the
+// jitter keeping the two runs apart.
+func backoffExample(db *sql.DB) {
+    const maxDelay = 16 * time.Millisecond
+    var runs [2][]time.Duration
+    for i := range runs {
+        backoff := BackoffConfig{
+            BaseDelay: time.Millisecond,
+            MaxDelay:  maxDelay,
+            OnBackoff: func(retry int, delay time.Duration) { runs[i] = append(runs[i], delay) },
+        }
+        WithRetryBackoff(context.Background(), db, 8, backoff, nil, func(tx *sql.Tx) error {
+            return sqlite3.Error{Code: sqlite3.ErrBusy}
+        })
+    }
+
+    // Retry n waits between half and all of 1ms<<(n-1), capped at 16ms, so
+    // each wait is at least the whole of the one before until the cap
+    identical := 0
+    for _, run := range runs {
+        if len(run) != 7 {
+            log.Fatalf("8 conflicting attempts backed off %d times, want 7", len(run))
+        }
+    }
+    for i := range runs[0] {
+        ceiling := min(time.Millisecond<<i, maxDelay)
+        for _, run := range runs {
+            if run[i] < ceiling/2 || run[i] > ceiling {
+                log.Fatalf("backoff before retry %d = %v, want between %v and %v", i+1, run[i], ceiling/2, ceiling)
+            }
+            if i > 0 && ceiling < maxDelay && run[i] < run[i-1] {
+                log.Fatalf("backoff before retry %d = %v, shorter than the %v before it", i+1, run[i], run[i-1])
+            }
+        }
+        if runs[0][i] == runs[1][i] {
+            identical++
+        }
+    }
+    for i, run := range runs {
+        rounded := make([]time.Duration, len(run))
+        for j, d := range run {
+            rounded[j] = d.Round(10 * time.Microsecond)
+        }
+        fmt.Printf("Backoff run %d: %v\n", i+1, rounded)
+    }
+    fmt.Printf("Backoff: each delay within its doubling range under the %v cap, delays identical across runs: %d of %d\n",
+        maxDelay, identical, len(runs[0]))
+}
+
+// poolSizeExample runs the same batch of read-then-write increments with a
+// pool of 1 and of 8 connections. Whatever the pool size, the balance must
+// have gone up by exactly the number of commits, and any failure must be a
+// busy error from writing on a stale snapshot.
+func poolSizeExample(dir string) {
+    for _, conns := range []int{1, 8} {
+        db, err := openAccountsDB(filepath.Join(dir, fmt.Sprintf("pool-%d.db", conns)))
+        if err != nil {
+            log.Fatal(err)
+        }
+        result := RunConcurrent(db, conns, 50, func(tx *sql.Tx) error {
+            var balance int
+            if err := tx.QueryRow(selectBalance).Scan(&balance); err != nil {
+                return err
+            }
+            time.Sleep(time.Millisecond)
+            _, err := tx.Exec("UPDATE accounts SET balance = ? WHERE id = 1", balance+1)
+            return err
+        })
+
+        var balance int
+        db.QueryRow(selectBalance).Scan(&balance)
+        db.Close()
+        correct := balance == 100+result.Commits && result.Other == 0
+        fmt.Printf("Pool of %d: 50 transactions in %v, %d commits, %d busy, %d other errors, balance = %d (correct: %v)\n",
+            conns, result.Elapsed.Round(100*time.Microsecond), result.Commits, result.Retryable, result.Other,
+            balance, correct)
+        if !correct {
+            log.Fatalf("pool of %d: balance %d after %d commits and %d other errors", conns, balance, result.Commits, result.Other)
+        }
+    }
+}
+
+// contentionExample has each of goroutines add 1 to the balance increments
+// times, every increment a read then a write in its own WithRetry call, and
+// reports how many attempts the commits needed between them.
+func contentionExample(db *sql.DB, goroutines, increments int) {
+    var metrics RetryMetrics
     var wg sync.WaitGroup
-    wg.Add(2)
+    wg.Add(goroutines)
+    for g := 0; g < goroutines; g++ {
+        go func() {
+            defer wg.Done()
+            for i := 0; i < increments; i++ {
+                err := WithRetryMetrics(context.Background(), db, 100, &metrics, func(tx *sql.Tx) error {
+                    var balance int
+                    if err := tx.QueryRow(selectBalance).Scan(&balance); err != nil {
+                        return err
+                    }
+                    time.Sleep(time.Millisecond) // widen the window for another writer
+                    _, err := tx.Exec("UPDATE accounts SET balance = ? WHERE id = 1", balance+1)
+                    return err
+                })
+                if err != nil {
+                    fmt.Println("Increment failed:", err)
+                }
+            }
+        }()
+    }
+    wg.Wait()
 
-    go readCommittedExample(db, &wg)
+    stats := metrics.Stats()
+    var balance int
+    db.QueryRow(selectBalance).Scan(&balance)
+    fmt.Printf("%d goroutines: %d commits, %d conflicts, %d attempts (attempts = commits + conflicts: %v), balance = %d\n",
+        goroutines, stats.Commits, stats.Conflicts, stats.Attempts, stats.Attempts == stats.Commits+stats.Conflicts, balance)
+    if stats.Attempts != stats.Commits+stats.Conflicts || balance != 100+goroutines*increments {
+        log.Fatalf("%d goroutines: %d attempts for %d commits and %d conflicts, balance %d, want %d",
+            goroutines, stats.Attempts, stats.Commits, stats.Conflicts, balance, 100+goroutines*increments)
+    }
+}
 
-    // Simulate another transaction updating the balance
-    go func() {
-        defer wg.Done()
+func main() {
+    dir, err := os.MkdirTemp("", "isolation_levels")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
 
-        tx, err := db.Begin()
+    levels := []sql.IsolationLevel{sql.LevelReadCommitted, sql.LevelRepeatableRead, sql.LevelSerializable}
+    for _, level := range levels {
+        db, err := openAccountsDB(filepath.Join(dir, level.String()+".db"))
         if err != nil {
             log.Fatal(err)
         }
-        defer tx.Rollback()
 
-        _, err = tx.Exec("UPDATE accounts SET balance = balance + 50 WHERE id = 1")
+        // Another transaction adds 50 to the balance between the two reads
+        addFifty := func(db *sql.DB) error { return updateBalance(db, 50) }
+        initial, afterDelay, readErr := RunIsolationExample(db, level, 100*time.Millisecond, addFifty)
+        if readErr != nil {
+            fmt.Printf("%s: Error reading value: %v\n", level, readErr)
+        } else {
+            fmt.Printf("%s: Initial balance = %d, Balance after delay = %d\n", level, initial, afterDelay)
+            if sawUpdate := afterDelay != initial; sawUpdate != (level == sql.LevelReadCommitted) {
+                log.Fatalf("%s: second read saw the concurrent update: %v", level, sawUpdate)
+            }
+        }
+        db.Close()
+    }
+
+    for _, level := range levels {
+        db, err := openAccountsDB(filepath.Join(dir, "phantom "+level.String()+".db"))
         if err != nil {
-            fmt.Println("Error updating balance:", err)
-            return
+            log.Fatal(err)
         }
 
-        tx.Commit()
-    }()
+        first, second, delta, err := RunPhantomExample(db, level, 0)
+        if err != nil {
+            fmt.Printf("%s: Error counting rows: %v\n", level, err)
+        } else {
+            fmt.Printf("%s: Rows with balance > 50 = %d, then %d (phantoms: %d)\n", level, first, second, delta)
+            if (delta != 0) != (level == sql.LevelReadCommitted) {
+                log.Fatalf("%s: %d phantoms", level, delta)
+            }
+        }
+        db.Close()
+    }
 
-    wg.Wait()
+    // A rolled-back update is never visible; a committed one only to read committed
+    scenarios := []ConflictScenario{
+        {Delta: 25, Updates: 2, Commit: true},
+        {Delta: 25, Updates: 2, Commit: false},
+    }
+    for _, level := range levels {
+        for i, sc := range scenarios {
+            db, err := openAccountsDB(filepath.Join(dir, fmt.Sprintf("scenario-%d %s.db", i, level)))
+            if err != nil {
+                log.Fatal(err)
+            }
+            initial, afterDelay, err := RunConflictScenario(db, level, 0, sc)
+            if err != nil {
+                fmt.Printf("%s (%v): Error reading value: %v\n", level, sc, err)
+            } else {
+                fmt.Printf("%s (%v): balance %d, then %d\n", level, sc, initial, afterDelay)
+                if sawUpdate := afterDelay != initial; sawUpdate != (level == sql.LevelReadCommitted && sc.Commit) {
+                    log.Fatalf("%s (%v): second read saw the update: %v", level, sc, sawUpdate)
+                }
+            }
+            db.Close()
+        }
+    }
+
+    db, err := openAccountsDB(filepath.Join(dir, "retry.db"))
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer db.Close()
+    retryExample(db)
+    cancelExample(db)
+    backoffExample(db)
+    lostUpdateExample(dir)
+    poolSizeExample(dir)
+
+    // More concurrent writers, more conflicts per commit
+    for _, goroutines := range []int{1, 4, 16} {
+        db, err := openAccountsDB(filepath.Join(dir, fmt.Sprintf("contention-%d.db", goroutines)))
+        if err != nil {
+            log.Fatal(err)
+        }
+        contentionExample(db, goroutines, 10)
+        db.Close()
+    }
 }
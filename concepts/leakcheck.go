@@ -0,0 +1,33 @@
+package main
+
+// leakcheck.go has no main of its own; run it alongside the example that
+// uses it, e.g. go run pipeline.go leakcheck.go
+
+import (
+    "fmt"
+    "runtime"
+    "time"
+)
+
+const leakSettleTime = 100 * time.Millisecond
+
+// checkNoLeaks runs fn and returns an error if more goroutines are running
+// afterwards than before. Goroutines that are already on their way out may
+// take a moment to finish, so the count is polled until it settles or
+// leakSettleTime passes.
+func checkNoLeaks(fn func()) error {
+    before := runtime.NumGoroutine()
+    fn()
+
+    deadline := time.Now().Add(leakSettleTime)
+    for {
+        after := runtime.NumGoroutine()
+        if after <= before {
+            return nil
+        }
+        if time.Now().After(deadline) {
+            return fmt.Errorf("goroutine leak: %d before, %d after", before, after)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+var (
+    ErrUpgradeDeadlock = errors.New("upgrade deadlock: another shared holder is already upgrading")
+    ErrLockTimeout     = errors.New("lock wait timed out")
+)
+
+// rowLock is the lock state of one row. Any number of shared (S) holders
+// can coexist, but an exclusive (X) holder excludes everyone else.
+type rowLock struct {
+    shared    int
+    exclusive bool
+    upgrading bool // a shared holder is waiting to become exclusive
+}
+
+// LockTable models database row locking with shared/exclusive modes.
+type LockTable struct {
+    rows map[string]*rowLock
+    mu   sync.Mutex
+    cond *sync.Cond
+}
+
+func NewLockTable() *LockTable {
+    lt := &LockTable{rows: make(map[string]*rowLock)}
+    lt.cond = sync.NewCond(&lt.mu)
+    return lt
+}
+
+// row returns the lock state for id, creating it if needed; the caller must hold lt.mu.
+func (lt *LockTable) row(id string) *rowLock {
+    row, ok := lt.rows[id]
+    if !ok {
+        row = &rowLock{}
+        lt.rows[id] = row
+    }
+    return row
+}
+
+// LockShared blocks until no one holds id exclusively, then takes a shared lock.
+func (lt *LockTable) LockShared(id string) {
+    lt.mu.Lock()
+    defer lt.mu.Unlock()
+
+    // Look the row up again after every wait: Unlock drops rows nobody holds.
+    // New readers also queue behind a pending upgrade so it can't starve.
+    for row := lt.row(id); row.exclusive || row.upgrading; row = lt.row(id) {
+        lt.cond.Wait()
+    }
+    lt.row(id).shared++
+}
+
+// LockExclusive blocks until no one holds id at all, then takes it exclusively.
+func (lt *LockTable) LockExclusive(id string) {
+    lt.mu.Lock()
+    defer lt.mu.Unlock()
+
+    for row := lt.row(id); row.exclusive || row.shared > 0; row = lt.row(id) {
+        lt.cond.Wait()
+    }
+    lt.row(id).exclusive = true
+}
+
+// LockSharedDeadline is LockShared, but gives up with ErrLockTimeout if the
+// lock isn't granted within d, like a database lock timeout. A d of zero
+// never waits, like SELECT ... FOR SHARE NOWAIT.
+func (lt *LockTable) LockSharedDeadline(id string, d time.Duration) error {
+    lt.mu.Lock()
+    defer lt.mu.Unlock()
+
+    blocked := func(row *rowLock) bool { return row.exclusive || row.upgrading }
+    if err := lt.waitUntil(id, d, blocked); err != nil {
+        return fmt.Errorf("lock row %s shared: %w", id, err)
+    }
+    lt.row(id).shared++
+    return nil
+}
+
+// LockExclusiveDeadline is LockExclusive, but gives up with ErrLockTimeout
+// if the lock isn't granted within d, like SELECT ... FOR UPDATE with a
+// lock timeout (or NOWAIT when d is zero).
+func (lt *LockTable) LockExclusiveDeadline(id string, d time.Duration) error {
+    lt.mu.Lock()
+    defer lt.mu.Unlock()
+
+    blocked := func(row *rowLock) bool { return row.exclusive || row.shared > 0 }
+    if err := lt.waitUntil(id, d, blocked); err != nil {
+        return fmt.Errorf("lock row %s exclusive: %w", id, err)
+    }
+    lt.row(id).exclusive = true
+    return nil
+}
+
+// waitUntil waits on lt.cond while blocked reports true for id's row, for
+// at most d; the caller must hold lt.mu. sync.Cond has no timed wait, so a
+// timer broadcasts at the deadline to wake this waiter up to give up. The
+// timer takes lt.mu first, so its wakeup can't slip in between our check
+// and the Wait.
+func (lt *LockTable) waitUntil(id string, d time.Duration, blocked func(*rowLock) bool) error {
+    deadline := time.Now().Add(d)
+    timer := time.AfterFunc(d, func() {
+        lt.mu.Lock()
+        lt.cond.Broadcast()
+        lt.mu.Unlock()
+    })
+    defer timer.Stop()
+
+    for row := lt.row(id); blocked(row); row = lt.row(id) {
+        if !time.Now().Before(deadline) {
+            return ErrLockTimeout
+        }
+        lt.cond.Wait()
+    }
+    return nil
+}
+
+// Upgrade turns the caller's shared lock on id into an exclusive one once
+// every other shared holder has left. If another holder is already waiting
+// to upgrade, both would wait on each other forever, so this one fails with
+// ErrUpgradeDeadlock; the caller should release its shared lock and retry.
+func (lt *LockTable) Upgrade(id string) error {
+    lt.mu.Lock()
+    defer lt.mu.Unlock()
+
+    row := lt.row(id)
+    if row.upgrading {
+        return fmt.Errorf("upgrade row %s: %w", id, ErrUpgradeDeadlock)
+    }
+
+    // Our own shared lock keeps the row in the table while we wait
+    row.upgrading = true
+    for row.shared > 1 {
+        lt.cond.Wait()
+    }
+    row.upgrading = false
+    row.shared = 0
+    row.exclusive = true
+    return nil
+}
+
+// Unlock releases the caller's lock on id, whichever mode it was taken in.
+func (lt *LockTable) Unlock(id string) {
+    lt.mu.Lock()
+    defer lt.mu.Unlock()
+
+    row, ok := lt.rows[id]
+    if !ok {
+        return
+    }
+    if row.exclusive {
+        row.exclusive = false
+    } else if row.shared > 0 {
+        row.shared--
+    }
+    if !row.exclusive && row.shared == 0 {
+        delete(lt.rows, id)
+    }
+    lt.cond.Broadcast()
+}
+
+func main() {
+    lt := NewLockTable()
+    wait := 50 * time.Millisecond
+
+    // Shared locks coexist
+    lt.LockShared("row1")
+    err := lt.LockSharedDeadline("row1", wait)
+    fmt.Println("Second shared lock granted:", err == nil)
+    if err != nil {
+        log.Fatalf("a second shared lock was not granted: %v", err)
+    }
+
+    // An exclusive lock waits for every shared holder to leave
+    done := make(chan struct{})
+    go func() {
+        lt.LockExclusive("row1")
+        close(done)
+    }()
+    time.Sleep(wait)
+    lt.Unlock("row1")
+    select {
+    case <-done:
+        log.Fatal("exclusive lock granted while a shared holder was left")
+    case <-time.After(wait):
+        fmt.Println("Exclusive lock granted with one shared holder left: false")
+    }
+    lt.Unlock("row1")
+    <-done
+    fmt.Println("Exclusive lock granted once all shared holders left: true")
+
+    // A shared request waits behind the exclusive holder
+    err = lt.LockSharedDeadline("row1", wait)
+    fmt.Println("Shared lock granted while exclusively held:", err == nil)
+    if !errors.Is(err, ErrLockTimeout) {
+        log.Fatalf("shared request on an exclusively held row returned %v, want %v", err, ErrLockTimeout)
+    }
+    lt.Unlock("row1")
+
+    // Two shared holders both try to upgrade; one must back off
+    lt.LockShared("row2")
+    lt.LockShared("row2")
+    errs := make(chan error, 2)
+    for i := 0; i < 2; i++ {
+        go func() {
+            err := lt.Upgrade("row2")
+            if err != nil {
+                lt.Unlock("row2") // Give up the shared lock so the other upgrade can finish
+            }
+            errs <- err
+        }()
+    }
+    first, second := <-errs, <-errs
+    fmt.Println("Concurrent upgrades:", first, "/", second)
+    if (first == nil) == (second == nil) {
+        log.Fatalf("want exactly one upgrade to succeed, got %v / %v", first, second)
+    }
+
+    deadlineExample(lt)
+}
+
+// deadlineExample requests a row another goroutine holds exclusively, once
+// with a deadline and once with NOWAIT, and then after it is released.
+func deadlineExample(lt *LockTable) {
+    lt.LockExclusive("row3")
+
+    errs := make(chan error, 1)
+    start := time.Now()
+    go func() { errs <- lt.LockExclusiveDeadline("row3", 20*time.Millisecond) }()
+    err := <-errs
+    fmt.Printf("Exclusive request with a 20ms deadline: %v after %v (timed out: %v)\n",
+        err, time.Since(start).Round(time.Millisecond), errors.Is(err, ErrLockTimeout))
+    if !errors.Is(err, ErrLockTimeout) {
+        log.Fatalf("exclusive request on a held row returned %v, want %v", err, ErrLockTimeout)
+    }
+    err = lt.LockSharedDeadline("row3", 0)
+    fmt.Println("Shared request with NOWAIT:", err)
+    if !errors.Is(err, ErrLockTimeout) {
+        log.Fatalf("NOWAIT request on a held row returned %v, want %v", err, ErrLockTimeout)
+    }
+
+    lt.Unlock("row3")
+    err = lt.LockExclusiveDeadline("row3", 20*time.Millisecond)
+    fmt.Println("Exclusive request with a deadline once released:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+    lt.Unlock("row3")
+}
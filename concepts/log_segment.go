@@ -0,0 +1,296 @@
+package main
+
+// log_segment.go has no main of its own; the memtable flushes into it. Run
+// them together: go run memtable.go skiplist.go log_segment.go
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "sync"
+)
+
+// recordHeaderSize is the two uint32 lengths in front of every record.
+const recordHeaderSize = 8
+
+// LogSegment is a Bitcask-style append-only log. Every Append writes a
+// record to the end of the file, and an in-memory index maps each key to the
+// offset of its latest record, so a read costs one seek no matter how many
+// times the key was overwritten. Older records stay in the file as garbage.
+type LogSegment struct {
+    w     io.Writer   // appends go here
+    r     io.ReaderAt // reads come from here; for a file, the same one
+    file  *os.File
+    path  string
+    size  int64            // bytes written, which is the next record's offset
+    index map[string]int64 // key -> offset of its latest record
+    mu    sync.RWMutex     // Append holds it exclusively, Read shared
+
+    compactMu sync.Mutex // one Compact at a time
+}
+
+// CreateLogSegment creates an empty segment at path, replacing any file
+// already there.
+func CreateLogSegment(path string) (*LogSegment, error) {
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return nil, err
+    }
+    return &LogSegment{w: file, r: file, file: file, path: path, index: make(map[string]int64)}, nil
+}
+
+func (s *LogSegment) Close() error {
+    return s.file.Close()
+}
+
+// Append writes a record of key and value and points the index at it:
+//
+//  keyLen uint32 | valueLen uint32 | key | value
+//
+// It returns the record's offset in the segment.
+func (s *LogSegment) Append(key string, value []byte) (int64, error) {
+    record := appendRecord(nil, key, value)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    offset := s.size
+    if _, err := s.w.Write(record); err != nil {
+        return 0, fmt.Errorf("append %q: %w", key, err)
+    }
+    s.size += int64(len(record))
+    s.index[key] = offset
+    return offset, nil
+}
+
+// Read returns the latest value appended for key.
+func (s *LogSegment) Read(key string) ([]byte, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    offset, ok := s.index[key]
+    if !ok {
+        return nil, false
+    }
+    recordKey, value, err := readRecord(s.r, offset)
+    if err != nil || recordKey != key {
+        return nil, false
+    }
+    return value, true
+}
+
+func appendRecord(buf []byte, key string, value []byte) []byte {
+    buf = binary.BigEndian.AppendUint32(buf, uint32(len(key)))
+    buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+    buf = append(buf, key...)
+    return append(buf, value...)
+}
+
+// readRecord decodes the record at offset.
+func readRecord(r io.ReaderAt, offset int64) (string, []byte, error) {
+    header := make([]byte, recordHeaderSize)
+    if _, err := r.ReadAt(header, offset); err != nil {
+        return "", nil, fmt.Errorf("read record header at %d: %w", offset, err)
+    }
+    keyLen := binary.BigEndian.Uint32(header[0:4])
+    valueLen := binary.BigEndian.Uint32(header[4:8])
+
+    body := make([]byte, keyLen+valueLen)
+    if _, err := r.ReadAt(body, offset+recordHeaderSize); err != nil {
+        return "", nil, fmt.Errorf("read record at %d: %w", offset, err)
+    }
+    return string(body[:keyLen]), body[keyLen:], nil
+}
+
+// Compact rewrites the segment keeping only the latest record of each key,
+// then swaps the new file in place of the old one. Records never change
+// once written, so the copy is made from a snapshot of the index while
+// reads and appends carry on against the old file. Only the final step,
+// which copies whatever was appended in the meantime and swaps the files,
+// holds the segment lock exclusively.
+func (s *LogSegment) Compact() error {
+    s.compactMu.Lock()
+    defer s.compactMu.Unlock()
+
+    s.mu.RLock()
+    snapshot := make(map[string]int64, len(s.index))
+    for key, offset := range s.index {
+        snapshot[key] = offset
+    }
+    snapshotSize := s.size
+    s.mu.RUnlock()
+
+    tmpPath := s.path + ".compact"
+    file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    ok := false
+    defer func() {
+        if !ok {
+            file.Close()
+            os.Remove(tmpPath)
+        }
+    }()
+
+    index := make(map[string]int64, len(snapshot))
+    var buf []byte
+    bufferLive := func(live map[string]int64) error {
+        for key, offset := range live {
+            _, value, err := readRecord(s.r, offset)
+            if err != nil {
+                return err
+            }
+            index[key] = int64(len(buf))
+            buf = appendRecord(buf, key, value)
+        }
+        return nil
+    }
+    if err := bufferLive(snapshot); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    // Keys appended while we copied point past the snapshot
+    appended := make(map[string]int64)
+    for key, offset := range s.index {
+        if offset >= snapshotSize {
+            appended[key] = offset
+        }
+    }
+    if err := bufferLive(appended); err != nil {
+        return err
+    }
+    if _, err := file.Write(buf); err != nil {
+        return fmt.Errorf("write compacted segment: %w", err)
+    }
+    if err := file.Sync(); err != nil {
+        return fmt.Errorf("sync compacted segment: %w", err)
+    }
+    if err := os.Rename(tmpPath, s.path); err != nil {
+        return err
+    }
+    ok = true
+
+    s.file.Close()
+    s.w, s.r, s.file = file, file, file
+    s.size = int64(len(buf))
+    s.index = index
+    return nil
+}
+
+// Size returns the bytes in the segment, live records and garbage alike.
+func (s *LogSegment) Size() int64 {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.size
+}
+
+// logSegmentExample keeps its files in dir.
+func logSegmentExample(dir string) {
+    seg, err := CreateLogSegment(filepath.Join(dir, "segment.log"))
+    if err != nil {
+        fmt.Println("Error creating segment:", err)
+        return
+    }
+    defer seg.Close()
+
+    // Several versions of one key: the index always points at the newest
+    for _, v := range []string{"v1", "v2", "v3"} {
+        offset, _ := seg.Append("color", []byte(v))
+        fmt.Printf("Appended color=%s at offset %d\n", v, offset)
+    }
+    value, ok := seg.Read("color")
+    fmt.Printf("Read color = %s (found: %v)\n", value, ok)
+    if !ok || string(value) != "v3" {
+        log.Fatalf("read color = %s (found: %v), want v3", value, ok)
+    }
+
+    // Multiple keys round-trip
+    keys := map[string]string{"alice": "100", "bob": "250", "carol": ""}
+    for k, v := range keys {
+        seg.Append(k, []byte(v))
+    }
+    wrong := 0
+    for k, v := range keys {
+        if got, ok := seg.Read(k); !ok || string(got) != v {
+            wrong++
+        }
+    }
+    _, ok = seg.Read("dave")
+    fmt.Println("Keys read back wrong:", wrong, "- unknown key found:", ok)
+    fmt.Println("Segment size:", seg.Size(), "bytes")
+    if wrong != 0 || ok {
+        log.Fatalf("%d keys read back wrong, unknown key found: %v", wrong, ok)
+    }
+
+    compactionExample(dir)
+}
+
+// countRecords walks a segment's records from the start.
+func countRecords(r io.ReaderAt, size int64) int {
+    count := 0
+    for offset := int64(0); offset < size; count++ {
+        key, value, err := readRecord(r, offset)
+        if err != nil {
+            break
+        }
+        offset += recordHeaderSize + int64(len(key)+len(value))
+    }
+    return count
+}
+
+func compactionExample(dir string) {
+    seg, err := CreateLogSegment(filepath.Join(dir, "compact.log"))
+    if err != nil {
+        fmt.Println("Error creating segment:", err)
+        return
+    }
+    defer seg.Close()
+
+    // 100 overwrites of each of 3 keys; only the last of each is live
+    keys := []string{"a", "b", "c"}
+    for i := 0; i < 100; i++ {
+        for _, key := range keys {
+            seg.Append(key, []byte(fmt.Sprintf("%s-%d", key, i)))
+        }
+    }
+    before := seg.Size()
+
+    // Reads keep working on the old file while compaction runs
+    var wg sync.WaitGroup
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 1000; i++ {
+            if value, ok := seg.Read("b"); !ok || string(value) != "b-99" {
+                log.Fatalf("read during compaction returned %s (found: %v), want b-99", value, ok)
+            }
+        }
+    }()
+    err = seg.Compact()
+    wg.Wait()
+    if err != nil {
+        fmt.Println("Compact failed:", err)
+        return
+    }
+
+    records := countRecords(seg.r, seg.Size())
+    fmt.Printf("Compaction: %d -> %d bytes, %d records for %d keys\n",
+        before, seg.Size(), records, len(keys))
+    if records != len(keys) {
+        log.Fatalf("compaction kept %d records for %d keys", records, len(keys))
+    }
+    for _, key := range keys {
+        value, _ := seg.Read(key)
+        fmt.Printf("After compaction %s = %s\n", key, value)
+        if string(value) != key+"-99" {
+            log.Fatalf("after compaction %s = %s, want %s-99", key, value, key)
+        }
+    }
+}
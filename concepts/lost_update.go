@@ -0,0 +1,132 @@
+package main
+
+// lost_update.go builds on the accounts database from isolation_levels.go and
+// has no main of its own: go run isolation_levels.go lost_update.go
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log"
+    "path/filepath"
+    "sync"
+)
+
+// concurrentAdds runs add once per delta, each on its own goroutine, and
+// returns the balance once both have finished. An add calls bothRead after
+// its read, and bothRead returns once the other add has read too, so a
+// read-modify-write add can make sure both reads happen before either write.
+// An add that returns without calling bothRead still counts as having read,
+// so a failure on one goroutine can't leave the other waiting forever.
+func concurrentAdds(db *sql.DB, deltas [2]int, add func(delta int, bothRead func()) error) (int, error) {
+    var reads, done sync.WaitGroup
+    reads.Add(len(deltas))
+    done.Add(len(deltas))
+    errs := make(chan error, len(deltas))
+    for _, delta := range deltas {
+        go func(delta int) {
+            defer done.Done()
+            var once sync.Once
+            readDone := func() { once.Do(reads.Done) }
+            defer readDone()
+
+            err := add(delta, func() {
+                readDone()
+                reads.Wait()
+            })
+            if err != nil {
+                errs <- err
+            }
+        }(delta)
+    }
+    done.Wait()
+    close(errs)
+    if err := <-errs; err != nil {
+        return 0, err
+    }
+
+    var balance int
+    err := db.QueryRow(selectBalance).Scan(&balance)
+    return balance, err
+}
+
+// RunLostUpdate has two transactions at read committed each read the
+// balance, add their delta in application code and write the sum back. Both
+// read the same balance before either writes, so the second write overwrites
+// the first and one delta is lost. As in RunIsolationExample, read committed
+// is modeled by running each statement on its own. Returns the final balance.
+func RunLostUpdate(db *sql.DB, deltas [2]int) (int, error) {
+    return concurrentAdds(db, deltas, func(delta int, bothRead func()) error {
+        var balance int
+        err := db.QueryRow(selectBalance).Scan(&balance)
+        bothRead()
+        if err != nil {
+            return err
+        }
+
+        _, err = db.Exec("UPDATE accounts SET balance = ? WHERE id = 1", balance+delta)
+        return err
+    })
+}
+
+// RunAtomicAdd fixes the lost update by doing the addition in the UPDATE
+// itself, so the read and the write are one statement and each sees the
+// other's committed result. Returns the final balance.
+func RunAtomicAdd(db *sql.DB, deltas [2]int) (int, error) {
+    return concurrentAdds(db, deltas, func(delta int, _ func()) error {
+        return updateBalance(db, delta)
+    })
+}
+
+// RunSerializableAdd keeps the read-modify-write in application code but
+// runs it serializably under WithRetry. The first attempts still read the
+// same balance, but whichever writes second is writing from a stale snapshot;
+// SQLite rejects it and the retry reads the other's result. Returns the final
+// balance.
+func RunSerializableAdd(db *sql.DB, deltas [2]int) (int, error) {
+    return concurrentAdds(db, deltas, func(delta int, bothRead func()) error {
+        attempts := 0
+        return WithRetry(context.Background(), db, 5, func(tx *sql.Tx) error {
+            attempts++
+            var balance int
+            err := tx.QueryRow(selectBalance).Scan(&balance)
+            if attempts == 1 {
+                bothRead()
+            }
+            if err != nil {
+                return err
+            }
+
+            _, err = tx.Exec("UPDATE accounts SET balance = ? WHERE id = 1", balance+delta)
+            return err
+        })
+    })
+}
+
+func lostUpdateExample(dir string) {
+    deltas := [2]int{10, 20}
+    for i, run := range []struct {
+        name string
+        fn   func(db *sql.DB, deltas [2]int) (int, error)
+    }{
+        {"read-modify-write at read committed", RunLostUpdate},
+        {"atomic UPDATE balance = balance + ?", RunAtomicAdd},
+        {"read-modify-write, serializable with retry", RunSerializableAdd},
+    } {
+        db, err := openAccountsDB(filepath.Join(dir, fmt.Sprintf("lost-update-%d.db", i)))
+        if err != nil {
+            log.Fatal(err)
+        }
+        balance, err := run.fn(db, deltas)
+        db.Close()
+        if err != nil {
+            log.Fatalf("Lost update, %s: %v", run.name, err)
+        }
+        lost := balance != 100+deltas[0]+deltas[1]
+        fmt.Printf("Lost update, %s: 100 + %d + %d = %d (update lost: %v)\n",
+            run.name, deltas[0], deltas[1], balance, lost)
+        if lost != (i == 0) {
+            log.Fatalf("lost update, %s: update lost: %v", run.name, lost)
+        }
+    }
+}
@@ -0,0 +1,115 @@
+package main
+
+// lru.go has no main of its own; it is shared by the programs that cache
+// with it. Run them together, e.g. go run page_level_locking.go lru.go
+
+// lruNode is one entry in the cache's recency list.
+type lruNode[K comparable, V any] struct {
+    key        K
+    value      V
+    prev, next *lruNode[K, V]
+}
+
+// LRUCache holds up to capacity entries and evicts the least recently used
+// one to make room. The map finds a node in O(1) and the doubly linked list
+// reorders it in O(1), so Get and Put are both constant time. It is not
+// safe for concurrent use; callers lock around it.
+type LRUCache[K comparable, V any] struct {
+    capacity int
+    nodes    map[K]*lruNode[K, V]
+    head     lruNode[K, V] // sentinel: head.next is the most recently used, head.prev the least
+}
+
+func NewLRUCache[K comparable, V any](capacity int) *LRUCache[K, V] {
+    c := &LRUCache[K, V]{capacity: capacity, nodes: make(map[K]*lruNode[K, V])}
+    c.head.next = &c.head
+    c.head.prev = &c.head
+    return c
+}
+
+// Get returns key's value and marks it most recently used.
+func (c *LRUCache[K, V]) Get(key K) (V, bool) {
+    node, ok := c.nodes[key]
+    if !ok {
+        var zero V
+        return zero, false
+    }
+    c.moveToFront(node)
+    return node.value, true
+}
+
+// Put inserts or updates key as the most recently used entry, evicting the
+// least recently used entry if the cache is over capacity.
+func (c *LRUCache[K, V]) Put(key K, value V) {
+    if node, ok := c.nodes[key]; ok {
+        node.value = value
+        c.moveToFront(node)
+        return
+    }
+
+    node := &lruNode[K, V]{key: key, value: value}
+    c.nodes[key] = node
+    c.insertFront(node)
+    if len(c.nodes) > c.capacity {
+        c.Remove(c.head.prev.key)
+    }
+}
+
+// Peek returns key's value without marking it used.
+func (c *LRUCache[K, V]) Peek(key K) (V, bool) {
+    node, ok := c.nodes[key]
+    if !ok {
+        var zero V
+        return zero, false
+    }
+    return node.value, true
+}
+
+// Oldest returns the least recently used entry without touching it, so a
+// caller can clean it up before removing it.
+func (c *LRUCache[K, V]) Oldest() (K, V, bool) {
+    if len(c.nodes) == 0 {
+        var key K
+        var value V
+        return key, value, false
+    }
+    return c.head.prev.key, c.head.prev.value, true
+}
+
+func (c *LRUCache[K, V]) Remove(key K) {
+    node, ok := c.nodes[key]
+    if !ok {
+        return
+    }
+    c.unlink(node)
+    delete(c.nodes, key)
+}
+
+func (c *LRUCache[K, V]) Len() int { return len(c.nodes) }
+
+// Keys returns every key from least to most recently used.
+func (c *LRUCache[K, V]) Keys() []K {
+    keys := make([]K, 0, len(c.nodes))
+    for node := c.head.prev; node != &c.head; node = node.prev {
+        keys = append(keys, node.key)
+    }
+    return keys
+}
+
+func (c *LRUCache[K, V]) moveToFront(node *lruNode[K, V]) {
+    c.unlink(node)
+    c.insertFront(node)
+}
+
+func (c *LRUCache[K, V]) insertFront(node *lruNode[K, V]) {
+    node.prev = &c.head
+    node.next = c.head.next
+    c.head.next.prev = node
+    c.head.next = node
+}
+
+func (c *LRUCache[K, V]) unlink(node *lruNode[K, V]) {
+    node.prev.next = node.next
+    node.next.prev = node.prev
+    node.prev, node.next = nil, nil
+}
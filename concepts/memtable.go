@@ -0,0 +1,138 @@
+// Run with skiplist.go and log_segment.go:
+// go run memtable.go skiplist.go log_segment.go
+package main
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strconv"
+    "sync"
+)
+
+// LSMStore is the write path of a log-structured merge tree. Writes go to
+// an in-memory skip list, the memtable. Once it holds flushThreshold keys it
+// is written out in key order as an immutable segment (an SSTable) and a
+// fresh memtable takes its place. A read checks the memtable first and then
+// the segments from newest to oldest, so the most recent write of a key
+// always wins.
+type LSMStore struct {
+    dir            string
+    flushThreshold int
+    mem            *SkipList
+    segments       []*LogSegment // oldest first
+    mu             sync.RWMutex  // Put holds it exclusively, Get shared
+}
+
+func NewLSMStore(dir string, flushThreshold int) *LSMStore {
+    return &LSMStore{dir: dir, flushThreshold: flushThreshold, mem: NewSkipList(1)}
+}
+
+func (s *LSMStore) Put(key, value int) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.mem.Insert(key, value)
+    if s.mem.Len() >= s.flushThreshold {
+        return s.flushLocked()
+    }
+    return nil
+}
+
+// flushLocked writes the memtable to a new segment in key order and starts
+// an empty memtable; the caller must hold s.mu for writing.
+func (s *LSMStore) flushLocked() error {
+    path := filepath.Join(s.dir, fmt.Sprintf("segment-%03d.sst", len(s.segments)))
+    seg, err := CreateLogSegment(path)
+    if err != nil {
+        return err
+    }
+    s.mem.Each(func(key, value int) {
+        if err == nil {
+            _, err = seg.Append(strconv.Itoa(key), []byte(strconv.Itoa(value)))
+        }
+    })
+    if err != nil {
+        seg.Close()
+        return fmt.Errorf("flush memtable: %w", err)
+    }
+
+    s.segments = append(s.segments, seg)
+    s.mem = NewSkipList(int64(len(s.segments) + 1))
+    return nil
+}
+
+// Get returns key's value and where it was found: "memtable" or a
+// segment's file name.
+func (s *LSMStore) Get(key int) (int, string, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    if value, ok := s.mem.Search(key); ok {
+        return value, "memtable", true
+    }
+    for i := len(s.segments) - 1; i >= 0; i-- {
+        if raw, ok := s.segments[i].Read(strconv.Itoa(key)); ok {
+            value, err := strconv.Atoi(string(raw))
+            if err != nil {
+                return 0, "", false
+            }
+            return value, filepath.Base(s.segments[i].path), true
+        }
+    }
+    return 0, "", false
+}
+
+func (s *LSMStore) Close() error {
+    var err error
+    for _, seg := range s.segments {
+        if closeErr := seg.Close(); closeErr != nil && err == nil {
+            err = closeErr
+        }
+    }
+    return err
+}
+
+func memtableExample(dir string) {
+    store := NewLSMStore(dir, 4)
+    defer store.Close()
+
+    // Keys 1-4 fill the memtable and flush it; 5 and 6 start the next one
+    for key := 1; key <= 6; key++ {
+        store.Put(key, key*10)
+    }
+    // Key 2 is rewritten in the memtable, shadowing the flushed version
+    store.Put(2, 99)
+    fmt.Println("Segments after 7 writes:", len(store.segments), "- memtable keys:", store.mem.Len())
+
+    want := map[int]int{1: 10, 2: 99, 5: 50}
+    for _, key := range []int{1, 2, 5, 7} {
+        value, from, ok := store.Get(key)
+        fmt.Printf("Get %d = %d from %s (found: %v)\n", key, value, from, ok)
+        if wantValue, wantOK := want[key]; ok != wantOK || value != wantValue {
+            log.Fatalf("Get %d = %d (found: %v), want %d (found: %v)", key, value, ok, wantValue, wantOK)
+        }
+    }
+
+    // A second flush: key 1 now lives in two segments, and the newer one wins
+    store.Put(1, 11)
+    value, from, _ := store.Get(1)
+    fmt.Printf("After a second flush, Get 1 = %d from %s\n", value, from)
+    if value != 11 {
+        log.Fatalf("after a second flush, Get 1 = %d, want 11", value)
+    }
+}
+
+func main() {
+    dir, err := os.MkdirTemp("", "lsm")
+    if err != nil {
+        fmt.Println("Error creating temp dir:", err)
+        return
+    }
+    defer os.RemoveAll(dir)
+
+    skipListExample()
+    logSegmentExample(dir)
+    memtableExample(dir)
+}
@@ -2,30 +2,67 @@ package main
 
 import (
     "fmt"
+    "log"
+    "runtime"
     "sync"
+    "sync/atomic"
 )
 
-// ToDo scale up and benchmark against atomics
+func incrementMutex(counter *int64, mu *sync.Mutex, n int) {
+    for j := 0; j < n; j++ {
+        mu.Lock()
+        *counter++
+        mu.Unlock()
+    }
+}
+
+func incrementAtomic(counter *int64, n int) {
+    for j := 0; j < n; j++ {
+        atomic.AddInt64(counter, 1)
+    }
+}
+
+// benchmarkCounters times the same workload with a mutex and with atomics,
+// checks both reach the same count, and prints ns per increment.
+func benchmarkCounters(numGoroutines, incrementsPerGoroutine int) {
+    var mutexCounter, atomicCounter int64
+    var mutex sync.Mutex
+
+    mutexTime := timeGoroutines(numGoroutines, func(int) {
+        incrementMutex(&mutexCounter, &mutex, incrementsPerGoroutine)
+    })
+    atomicTime := timeGoroutines(numGoroutines, func(int) {
+        incrementAtomic(&atomicCounter, incrementsPerGoroutine)
+    })
+
+    total := float64(numGoroutines * incrementsPerGoroutine)
+    fmt.Printf("%4d goroutines: mutex %6.1f ns/op, atomic %6.1f ns/op, counts equal: %v\n",
+        numGoroutines,
+        float64(mutexTime.Nanoseconds())/total,
+        float64(atomicTime.Nanoseconds())/total,
+        mutexCounter == atomicCounter)
+    if mutexCounter != int64(total) || atomicCounter != int64(total) {
+        log.Fatalf("%d goroutines: mutex count %d, atomic count %d, want %d", numGoroutines, mutexCounter, atomicCounter, int64(total))
+    }
+}
 
 func main() {
     var counter int64
     var mutex sync.Mutex
-    var wg sync.WaitGroup
     numGoroutines := 10
     incrementsPerGoroutine := 1000
 
-    wg.Add(numGoroutines)
-    for i := 0; i < numGoroutines; i++ {
-        go func() {
-            defer wg.Done()
-            for j := 0; j < incrementsPerGoroutine; j++ {
-                mutex.Lock()
-                counter++
-                mutex.Unlock()
-            }
-        }()
+    timeGoroutines(numGoroutines, func(int) {
+        incrementMutex(&counter, &mutex, incrementsPerGoroutine)
+    })
+    fmt.Println("Final Counter:", counter)
+    if counter != int64(numGoroutines*incrementsPerGoroutine) {
+        log.Fatalf("counter is %d, want %d", counter, numGoroutines*incrementsPerGoroutine)
     }
 
-    wg.Wait()
-    fmt.Println("Final Counter:", counter)
+    // Scale up contention relative to the number of CPUs
+    procs := runtime.GOMAXPROCS(0)
+    for _, goroutines := range []int{1, procs, 4 * procs, 16 * procs} {
+        benchmarkCounters(goroutines, 100000)
+    }
 }
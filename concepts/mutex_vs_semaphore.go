@@ -1,52 +1,277 @@
 package main
 
 import (
+    "context"
+    "errors"
     "fmt"
+    "log"
     "sync"
     "time"
 )
 
-var (
-    counter     int
-    mutex       sync.Mutex
-    semaphore   = make(chan struct{}, 3) // Limit to 3 concurrent goroutines
-)
+// Counter is a counter guarded by its own mutex and semaphore, so each
+// example gets its own state instead of sharing package globals.
+type Counter struct {
+    value     int
+    mu        sync.Mutex
+    semaphore chan struct{}
+    work      time.Duration // simulated work per increment
+}
 
-func incrementWithMutex() {
-    mutex.Lock()
-    defer mutex.Unlock()
+// NewCounter returns a counter whose semaphore admits permits goroutines at
+// a time and whose increments each take work to finish.
+func NewCounter(permits int, work time.Duration) *Counter {
+    return &Counter{semaphore: make(chan struct{}, permits), work: work}
+}
 
-    counter++
-    fmt.Println("[Mutex] Counter:", counter)
-    time.Sleep(1 * time.Second) // Simulate some work
+func (c *Counter) Value() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.value
 }
 
-func incrementWithSemaphore() {
-    semaphore <- struct{}{} // Acquire a spot
-    defer func() { <-semaphore }() // Release the spot
+// IncWithMutex increments while holding the mutex for the whole simulated
+// work, so increments run one at a time. It returns the new value.
+func (c *Counter) IncWithMutex() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
 
-    counter++
-    fmt.Println("[Semaphore] Counter:", counter)
-    time.Sleep(1 * time.Second) // Simulate some work
+    c.value++
+    time.Sleep(c.work) // Simulate some work
+    return c.value
 }
 
-func main() {
-    fmt.Println("Starting Mutex example:")
-    for i := 0; i < 5; i++ {
-        go incrementWithMutex()
+// IncWithSemaphore lets up to cap(semaphore) increments do their work at
+// once. It returns the new value.
+func (c *Counter) IncWithSemaphore() int {
+    c.semaphore <- struct{}{}        // Acquire a spot
+    defer func() { <-c.semaphore }() // Release the spot
+
+    value := c.inc()
+    time.Sleep(c.work) // Simulate some work
+    return value
+}
+
+// inc bumps the value under the mutex. Several semaphore holders run at
+// once, so the semaphore alone doesn't protect it.
+func (c *Counter) inc() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.value++
+    return c.value
+}
+
+// IncWithSemaphoreCtx is IncWithSemaphore that gives up waiting for a
+// permit when ctx is done. It returns ctx.Err() without incrementing if it
+// never got a permit.
+func (c *Counter) IncWithSemaphoreCtx(ctx context.Context) error {
+    select {
+    case c.semaphore <- struct{}{}:
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+    defer func() { <-c.semaphore }()
+
+    c.inc()
+    time.Sleep(c.work)
+    return nil
+}
+
+// TryAcquire waits at most timeout for a semaphore permit, returning false
+// instead of blocking forever when none frees up. A true result must be
+// paired with a release (<-c.semaphore).
+func (c *Counter) TryAcquire(timeout time.Duration) bool {
+    select {
+    case c.semaphore <- struct{}{}:
+        return true
+    case <-time.After(timeout):
+        return false
+    }
+}
+
+// runConcurrently calls inc from n goroutines at once and waits for them.
+func runConcurrently(n int, inc func()) {
+    var wg sync.WaitGroup
+    wg.Add(n)
+    for i := 0; i < n; i++ {
+        go func() {
+            defer wg.Done()
+            inc()
+        }()
+    }
+    wg.Wait()
+}
+
+// countersExample checks that both methods reach the right count from many
+// goroutines, each on a counter of its own.
+func countersExample() {
+    byMutex, bySemaphore := NewCounter(3, 0), NewCounter(3, 0)
+    runConcurrently(1000, func() { byMutex.IncWithMutex() })
+    runConcurrently(1000, func() { bySemaphore.IncWithSemaphore() })
+    fmt.Println("[Counters] 1000 increments each - mutex:", byMutex.Value(), "semaphore:", bySemaphore.Value())
+    if byMutex.Value() != 1000 || bySemaphore.Value() != 1000 {
+        log.Fatalf("counters are %d and %d, want 1000", byMutex.Value(), bySemaphore.Value())
+    }
+}
+
+func semaphoreCtxExample() {
+    c := NewCounter(3, 0)
+
+    // Take every permit so the next call has to wait
+    for i := 0; i < cap(c.semaphore); i++ {
+        c.semaphore <- struct{}{}
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    result := make(chan error)
+    go func() { result <- c.IncWithSemaphoreCtx(ctx) }()
+
+    time.Sleep(50 * time.Millisecond)
+    cancel()
+    err := <-result
+    fmt.Println("[Semaphore ctx] Cancelled while saturated:", err, "- counter:", c.Value())
+    if !errors.Is(err, context.Canceled) || c.Value() != 0 {
+        log.Fatalf("cancelled increment returned %v and left the counter at %d", err, c.Value())
+    }
+
+    <-c.semaphore // Release one spot
+    err = c.IncWithSemaphoreCtx(context.Background())
+    fmt.Println("[Semaphore ctx] After a release:", err, "- counter:", c.Value())
+    if err != nil || c.Value() != 1 {
+        log.Fatalf("increment after a release returned %v and left the counter at %d", err, c.Value())
+    }
+}
+
+func tryAcquireExample() {
+    c := NewCounter(3, 0)
+
+    // Take every permit so the next attempt has to time out
+    for i := 0; i < cap(c.semaphore); i++ {
+        c.semaphore <- struct{}{}
+    }
+
+    start := time.Now()
+    ok := c.TryAcquire(200 * time.Millisecond)
+    fmt.Printf("[TryAcquire] Full semaphore: %v after %v\n", ok, time.Since(start).Round(time.Millisecond))
+    if ok {
+        log.Fatal("TryAcquire took a permit from a full semaphore")
+    }
+
+    <-c.semaphore // Release one spot
+    start = time.Now()
+    ok = c.TryAcquire(200 * time.Millisecond)
+    fmt.Printf("[TryAcquire] After a release: %v after %v\n", ok, time.Since(start).Round(time.Millisecond))
+    if !ok {
+        log.Fatal("TryAcquire timed out with a permit free")
+    }
+}
+
+// Semaphore is a weighted semaphore: callers can take several permits at
+// once and give up waiting when their context is cancelled.
+type Semaphore struct {
+    capacity  int
+    available int
+    mu        sync.Mutex
+    cond      *sync.Cond
+}
+
+func NewSemaphore(capacity int) *Semaphore {
+    s := &Semaphore{capacity: capacity, available: capacity}
+    s.cond = sync.NewCond(&s.mu)
+    return s
+}
+
+// Acquire blocks until n permits are free and takes them, or returns
+// ctx.Err() if the context is cancelled first.
+func (s *Semaphore) Acquire(ctx context.Context, n int) error {
+    if n > s.capacity {
+        return fmt.Errorf("acquire %d permits: semaphore capacity is %d", n, s.capacity)
+    }
+
+    // sync.Cond can't wait on a channel, so wake the waiters when ctx is done
+    stop := context.AfterFunc(ctx, func() {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        s.cond.Broadcast()
+    })
+    defer stop()
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for s.available < n {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        s.cond.Wait()
+    }
+    s.available -= n
+    return nil
+}
+
+// Release returns n permits and wakes any waiters.
+func (s *Semaphore) Release(n int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.available+n > s.capacity {
+        panic("semaphore: released more permits than acquired")
+    }
+    s.available += n
+    s.cond.Broadcast()
+}
+
+func weightedSemaphoreExample() {
+    sem := NewSemaphore(3)
+    sem.Acquire(context.Background(), 2)
+
+    // Only one permit is left, so asking for two blocks until the timeout
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    err := sem.Acquire(ctx, 2)
+    fmt.Println("[Weighted] Acquire(2) while oversubscribed:", err)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        log.Fatalf("oversubscribed Acquire returned %v, want %v", err, context.DeadlineExceeded)
     }
 
-    // Wait for Mutex example to complete
-    time.Sleep(6 * time.Second)
+    // Once the permits are released all three can be taken at once
+    sem.Release(2)
+    err = sem.Acquire(context.Background(), 3)
+    fmt.Println("[Weighted] Acquire(3) after release:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+    sem.Release(3)
+    fmt.Println("[Weighted] Permits available at the end:", sem.available)
+    if sem.available != sem.capacity {
+        log.Fatalf("%d of %d permits available at the end", sem.available, sem.capacity)
+    }
+}
 
-    // Reset counter for the Semaphore example
-    counter = 0
+func main() {
+    // Each phase gets its own counter, so both count up from zero
+    mutexCounter := NewCounter(3, 1*time.Second)
+    fmt.Println("Starting Mutex example:")
+    runConcurrently(5, func() { fmt.Println("[Mutex] Counter:", mutexCounter.IncWithMutex()) })
+    if n := mutexCounter.Value(); n != 5 {
+        log.Fatalf("mutex counter = %d after 5 increments", n)
+    }
 
+    semCounter := NewCounter(3, 1*time.Second) // Limit to 3 concurrent goroutines
     fmt.Println("\nStarting Semaphore example:")
-    for i := 0; i < 10; i++ {
-        go incrementWithSemaphore()
+    runConcurrently(10, func() { fmt.Println("[Semaphore] Counter:", semCounter.IncWithSemaphore()) })
+    if n := semCounter.Value(); n != 10 {
+        log.Fatalf("semaphore counter = %d after 10 increments", n)
     }
 
-    // Wait for Semaphore example to complete
-    time.Sleep(11 * time.Second)
+    fmt.Println("\nStarting weighted Semaphore example:")
+    weightedSemaphoreExample()
+
+    fmt.Println("\nStarting TryAcquire example:")
+    tryAcquireExample()
+
+    fmt.Println("\nStarting cancellable Semaphore example:")
+    semaphoreCtxExample()
+
+    fmt.Println()
+    countersExample()
 }
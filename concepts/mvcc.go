@@ -1,54 +1,1980 @@
+// Run with write_skew.go: go run mvcc.go write_skew.go
 package main
 
 import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
     "fmt"
+    "hash/fnv"
+    "io"
+    "log"
+    "maps"
+    "math"
+    "math/rand"
+    "sort"
+    "strings"
     "sync"
+    "sync/atomic"
     "time"
 )
 
 type VersionedValue struct {
+    txID      uint64 // orders versions; timestamp is kept for display
     timestamp int64
     value     int
+    deleted   bool // tombstone marking the key as removed at timestamp
 }
 
+func (v VersionedValue) Timestamp() int64 { return v.timestamp }
+func (v VersionedValue) Value() int       { return v.value }
+func (v VersionedValue) Deleted() bool    { return v.deleted }
+
+// rwLock is a reader/writer lock built from channels, so that waiting for it
+// can be abandoned when a context is cancelled; sync.RWMutex has no way to
+// stop waiting.
+type rwLock struct {
+    writer  chan struct{} // holds a token while a writer owns or is claiming the lock
+    readers chan struct{} // one token per active reader; a writer fills every slot
+}
+
+const maxReaders = 64
+
+func newRWLock() rwLock {
+    return rwLock{
+        writer:  make(chan struct{}, 1),
+        readers: make(chan struct{}, maxReaders),
+    }
+}
+
+func (l *rwLock) LockCtx(ctx context.Context) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    select {
+    case l.writer <- struct{}{}:
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+
+    // Claim every reader slot, which waits out the active readers
+    for i := 0; i < maxReaders; i++ {
+        select {
+        case l.readers <- struct{}{}:
+        case <-ctx.Done():
+            for ; i > 0; i-- {
+                <-l.readers
+            }
+            <-l.writer
+            return ctx.Err()
+        }
+    }
+    return nil
+}
+
+func (l *rwLock) Unlock() {
+    for i := 0; i < maxReaders; i++ {
+        <-l.readers
+    }
+    <-l.writer
+}
+
+func (l *rwLock) RLockCtx(ctx context.Context) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    // Pass through the writer gate, so readers queue behind a waiting writer
+    select {
+    case l.writer <- struct{}{}:
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+    defer func() { <-l.writer }()
+
+    select {
+    case l.readers <- struct{}{}:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (l *rwLock) RUnlock() {
+    <-l.readers
+}
+
+func (l *rwLock) Lock()  { l.LockCtx(context.Background()) }
+func (l *rwLock) RLock() { l.RLockCtx(context.Background()) }
+
+// keyEntry holds one key's versions behind the key's own lock, so writes to
+// different keys never wait on each other.
+type keyEntry struct {
+    lock     sync.RWMutex
+    versions []VersionedValue
+}
+
+// mvccShard is one stripe of the key space. Its lock guards the map of
+// entries: single-key operations hold it shared while they use an entry,
+// and it is taken exclusively only to add a key or for operations that
+// span the whole store.
+type mvccShard struct {
+    data map[string]*keyEntry
+    lock rwLock
+}
+
+// acquire read-locks the shard and returns key's entry, creating it first if
+// create is set; otherwise the entry is nil for a key never written. On
+// success the caller must release shard.lock with RUnlock.
+func (shard *mvccShard) acquire(ctx context.Context, key string, create bool) (*keyEntry, error) {
+    for {
+        if err := shard.lock.RLockCtx(ctx); err != nil {
+            return nil, err
+        }
+        if entry := shard.data[key]; entry != nil || !create {
+            return entry, nil
+        }
+        shard.lock.RUnlock()
+
+        // Adding a key needs the exclusive lock. Check again once it is
+        // held, since another writer may have added the key in between,
+        // then loop to look the entry up again under the shared lock
+        if err := shard.lock.LockCtx(ctx); err != nil {
+            return nil, err
+        }
+        shard.entryLocked(key)
+        shard.lock.Unlock()
+    }
+}
+
+// entryLocked returns key's entry, creating it if needed; the caller must
+// hold shard.lock exclusively.
+func (shard *mvccShard) entryLocked(key string) *keyEntry {
+    entry := shard.data[key]
+    if entry == nil {
+        entry = &keyEntry{}
+        shard.data[key] = entry
+    }
+    return entry
+}
+
+const defaultShards = 16
+
 type MVCCStore struct {
-    data map[string][]VersionedValue
-    lock sync.RWMutex
+    shards      []mvccShard
+    ssi         ssiTracker
+    txID        uint64 // last assigned transaction ID, bumped atomically on each commit
+    commitLock  sync.RWMutex // held shared while a commit appends, exclusively by BeginTx
+    gcHorizon   int64  // versions before this time may have been garbage collected
+    gcHorizonTx uint64 // newest transaction ID at or before gcHorizon
+
+    maxVersionsPerKey int // 0 means unlimited
+
+    // ReadAfter waiters sleep on newVersion until writeGen changes
+    notifyMu   sync.Mutex
+    newVersion *sync.Cond
+    writeGen   uint64 // bumped under notifyMu on every append while anyone waits
+    waiters    int64  // ReadAfter calls in progress, updated atomically
+}
+
+func NewMVCCStore() *MVCCStore {
+    return newShardedMVCCStore(defaultShards)
+}
+
+// newShardedMVCCStore splits the key space into n shards; n = 1 puts every
+// key behind a single lock.
+func newShardedMVCCStore(n int) *MVCCStore {
+    store := &MVCCStore{
+        shards: make([]mvccShard, n),
+        ssi:    ssiTracker{active: make(map[*Tx]bool)},
+    }
+    store.newVersion = sync.NewCond(&store.notifyMu)
+    for i := range store.shards {
+        store.shards[i] = mvccShard{
+            data: make(map[string]*keyEntry),
+            lock: newRWLock(),
+        }
+    }
+    return store
+}
+
+func (store *MVCCStore) shardIndex(key string) int {
+    h := fnv.New32a()
+    h.Write([]byte(key))
+    return int(h.Sum32() % uint32(len(store.shards)))
+}
+
+func (store *MVCCStore) shardFor(key string) *mvccShard {
+    return &store.shards[store.shardIndex(key)]
+}
+
+// lockAll write-locks every shard in index order, for operations that must
+// see or change the whole store at once.
+func (store *MVCCStore) lockAll() {
+    for i := range store.shards {
+        store.shards[i].lock.Lock()
+    }
+}
+
+func (store *MVCCStore) unlockAll() {
+    for i := range store.shards {
+        store.shards[i].lock.Unlock()
+    }
+}
+
+func (store *MVCCStore) rLockAll() {
+    for i := range store.shards {
+        store.shards[i].lock.RLock()
+    }
+}
+
+func (store *MVCCStore) rUnlockAll() {
+    for i := range store.shards {
+        store.shards[i].lock.RUnlock()
+    }
+}
+
+// NewMVCCStoreWithLimit returns a store that keeps at most n versions per
+// key, dropping the oldest version when a write would exceed the limit.
+func NewMVCCStoreWithLimit(n int) *MVCCStore {
+    store := NewMVCCStore()
+    store.maxVersionsPerKey = n
+    return store
+}
+
+func (store *MVCCStore) Write(key string, value int) {
+    store.WriteCtx(context.Background(), key, value)
+}
+
+// WriteCtx is Write that gives up with ctx.Err() if the context is done
+// before the shard lock is acquired. Key locks are only ever held for a
+// single append or lookup, so they are not waited on with the context.
+func (store *MVCCStore) WriteCtx(ctx context.Context, key string, value int) error {
+    return store.writeKey(ctx, key, func(entry *keyEntry) error {
+        store.appendLocked(entry, value, false)
+        return nil
+    })
+}
+
+// writeKey runs fn with key's entry write-locked.
+func (store *MVCCStore) writeKey(ctx context.Context, key string, fn func(entry *keyEntry) error) error {
+    shard := store.shardFor(key)
+    entry, err := shard.acquire(ctx, key, true)
+    if err != nil {
+        return err
+    }
+    defer shard.lock.RUnlock()
+
+    entry.lock.Lock()
+    defer entry.lock.Unlock()
+    return fn(entry)
+}
+
+// readKey runs fn with key's entry read-locked, or with nil if the key has
+// never been written.
+func (store *MVCCStore) readKey(ctx context.Context, key string, fn func(entry *keyEntry)) error {
+    shard := store.shardFor(key)
+    entry, err := shard.acquire(ctx, key, false)
+    if err != nil {
+        return err
+    }
+    defer shard.lock.RUnlock()
+
+    if entry == nil {
+        fn(nil)
+        return nil
+    }
+    entry.lock.RLock()
+    defer entry.lock.RUnlock()
+    fn(entry)
+    return nil
+}
+
+// Delete appends a tombstone so snapshots after now see the key as absent,
+// while older snapshots still see the previous value.
+func (store *MVCCStore) Delete(key string) {
+    store.writeKey(context.Background(), key, func(entry *keyEntry) error {
+        store.appendLocked(entry, 0, true)
+        return nil
+    })
+}
+
+// ConflictError reports that key was written after a transaction's snapshot.
+type ConflictError struct {
+    Key       string
+    Timestamp int64 // timestamp of the conflicting version
+}
+
+func (e *ConflictError) Error() string {
+    return fmt.Sprintf("write conflict on key %q: version at %d is newer than snapshot", e.Key, e.Timestamp)
+}
+
+// WriteIfUnchanged appends value only if no version of key was written after
+// snapshotTime, giving optimistic concurrency control: the first writer wins
+// and later writers from the same snapshot get a ConflictError.
+func (store *MVCCStore) WriteIfUnchanged(key string, value int, snapshotTime int64) error {
+    return store.writeKey(context.Background(), key, func(entry *keyEntry) error {
+        versions := entry.versions
+        if n := len(versions); n > 0 && versions[n-1].timestamp > snapshotTime {
+            return &ConflictError{Key: key, Timestamp: versions[n-1].timestamp}
+        }
+        store.appendLocked(entry, value, false)
+        return nil
+    })
+}
+
+// commitStamp is the transaction ID and timestamp shared by every version
+// one commit writes.
+type commitStamp struct {
+    txID      uint64
+    timestamp int64
+}
+
+// beginCommit takes the next transaction ID for a commit about to append its
+// versions. The ID is assigned before the appends finish, so the commit lock
+// is held shared until endCommit, keeping BeginTx from taking a snapshot
+// that includes the ID while only some of its versions are in place.
+func (store *MVCCStore) beginCommit() commitStamp {
+    store.commitLock.RLock()
+    return commitStamp{txID: atomic.AddUint64(&store.txID, 1), timestamp: time.Now().UnixNano()}
+}
+
+func (store *MVCCStore) endCommit() {
+    store.commitLock.RUnlock()
+}
+
+// appendLocked adds a new version to entry as a commit of its own; the
+// caller must hold entry.lock for writing.
+func (store *MVCCStore) appendLocked(entry *keyEntry, value int, deleted bool) {
+    stamp := store.beginCommit()
+    defer store.endCommit()
+    store.appendVersionLocked(entry, stamp, value, deleted)
+}
+
+// appendVersionLocked adds a version written by the commit stamp belongs
+// to; the caller must hold entry.lock for writing.
+func (store *MVCCStore) appendVersionLocked(entry *keyEntry, stamp commitStamp, value int, deleted bool) {
+    version := VersionedValue{
+        txID:      stamp.txID,
+        timestamp: stamp.timestamp,
+        value:     value,
+        deleted:   deleted,
+    }
+    versions := append(entry.versions, version)
+
+    // Over the limit: shift out the oldest version, which only the oldest
+    // snapshots could still need
+    if limit := store.maxVersionsPerKey; limit > 0 && len(versions) > limit {
+        n := copy(versions, versions[len(versions)-limit:])
+        for i := n; i < len(versions); i++ {
+            versions[i] = VersionedValue{}
+        }
+        versions = versions[:n]
+    }
+    entry.versions = versions
+    store.notifyWrite()
+}
+
+// notifyWrite wakes every ReadAfter waiter to recheck its key. With no
+// ReadAfter in progress it only loads the waiter count, so writes don't
+// all meet on notifyMu. A waiter registers before it checks its key, and
+// that check takes the key lock the writer holds now, so a waiter that
+// registers too late to be counted here still sees this write.
+func (store *MVCCStore) notifyWrite() {
+    if atomic.LoadInt64(&store.waiters) == 0 {
+        return
+    }
+    store.wakeWaiters()
+}
+
+// wakeWaiters bumps writeGen and wakes every ReadAfter waiter. Waiters
+// never hold notifyMu while taking a shard or key lock, so it is safe to
+// call with those held.
+func (store *MVCCStore) wakeWaiters() {
+    store.notifyMu.Lock()
+    defer store.notifyMu.Unlock()
+    store.writeGen++
+    store.newVersion.Broadcast()
+}
+
+var ErrKeyDeleted = errors.New("key deleted")
+
+// ReadAfter blocks until key has a version with a timestamp at or after
+// minTime and returns its value, or ErrKeyDeleted if that version is a
+// tombstone.
+func (store *MVCCStore) ReadAfter(key string, minTime time.Time) (int, error) {
+    return store.ReadAfterCtx(context.Background(), key, minTime)
+}
+
+// ReadAfterCtx is ReadAfter that gives up with ctx.Err() once the context
+// is done. There is one condition variable for the whole store, so a write
+// to any key wakes every waiter, and each rechecks its own key.
+func (store *MVCCStore) ReadAfterCtx(ctx context.Context, key string, minTime time.Time) (int, error) {
+    atomic.AddInt64(&store.waiters, 1)
+    defer atomic.AddInt64(&store.waiters, -1)
+
+    // sync.Cond can't wait on a channel, so wake the waiters when ctx is done
+    stop := context.AfterFunc(ctx, store.wakeWaiters)
+    defer stop()
+
+    min := minTime.UnixNano()
+    for {
+        store.notifyMu.Lock()
+        gen := store.writeGen
+        store.notifyMu.Unlock()
+
+        // Any append after gen was read bumps writeGen, so it can't be missed
+        var latest VersionedValue
+        found := false
+        err := store.readKey(ctx, key, func(entry *keyEntry) {
+            if entry != nil && len(entry.versions) > 0 {
+                latest = entry.versions[len(entry.versions)-1]
+                found = latest.timestamp >= min
+            }
+        })
+        if err != nil {
+            return 0, err
+        }
+        if found {
+            if latest.deleted {
+                return 0, fmt.Errorf("read %q: %w", key, ErrKeyDeleted)
+            }
+            return latest.value, nil
+        }
+
+        store.notifyMu.Lock()
+        for store.writeGen == gen && ctx.Err() == nil {
+            store.newVersion.Wait()
+        }
+        store.notifyMu.Unlock()
+        if err := ctx.Err(); err != nil {
+            return 0, err
+        }
+    }
+}
+
+// VersionCount returns how many versions of key are currently stored.
+func (store *MVCCStore) VersionCount(key string) int {
+    count := 0
+    store.readKey(context.Background(), key, func(entry *keyEntry) {
+        if entry != nil {
+            count = len(entry.versions)
+        }
+    })
+    return count
+}
+
+func (store *MVCCStore) Read(key string, snapshotTime int64) (int, bool) {
+    value, ok, _ := store.ReadCtx(context.Background(), key, snapshotTime)
+    return value, ok
+}
+
+// ReadCtx is Read that gives up with ctx.Err() if the context is done
+// before the shard lock is acquired.
+func (store *MVCCStore) ReadCtx(ctx context.Context, key string, snapshotTime int64) (int, bool, error) {
+    var value int
+    var ok bool
+    err := store.readKey(ctx, key, func(entry *keyEntry) {
+        value, ok = store.readLocked(entry, snapshotTime)
+    })
+    return value, ok, err
+}
+
+// Latest returns the newest version of key, without the caller having to
+// capture a timestamp that might predate a write it just made.
+func (store *MVCCStore) Latest(key string) (int, bool) {
+    var value int
+    var ok bool
+    store.readKey(context.Background(), key, func(entry *keyEntry) {
+        if entry == nil || len(entry.versions) == 0 {
+            return
+        }
+        newest := entry.versions[len(entry.versions)-1]
+        value, ok = newest.value, !newest.deleted
+    })
+    return value, ok
+}
+
+// History returns a copy of every retained version of key, oldest first,
+// or an empty slice if the key has never been written.
+func (store *MVCCStore) History(key string) []VersionedValue {
+    history := []VersionedValue{}
+    store.readKey(context.Background(), key, func(entry *keyEntry) {
+        if entry != nil {
+            history = append(history, entry.versions...)
+        }
+    })
+    return history
+}
+
+// Timeline renders key's versions as an ASCII timeline, one line per
+// version in timestamp order, each offset from the first retained version:
+//
+//  +0s        | 1
+//  +1.2ms     | 2
+//  +3.405ms   | (deleted)
+func (store *MVCCStore) Timeline(key string) string {
+    history := store.History(key)
+    if len(history) == 0 {
+        return fmt.Sprintf("%q has no versions\n", key)
+    }
+    sort.SliceStable(history, func(i, j int) bool {
+        return history[i].timestamp < history[j].timestamp
+    })
+
+    var b strings.Builder
+    first := history[0].timestamp
+    for _, v := range history {
+        value := fmt.Sprint(v.value)
+        if v.deleted {
+            value = "(deleted)"
+        }
+        offset := time.Duration(v.timestamp - first).Round(time.Microsecond)
+        fmt.Fprintf(&b, "+%-9v | %s\n", offset, value)
+    }
+    return b.String()
+}
+
+// MVCCStats summarizes how many versions the store is holding.
+type MVCCStats struct {
+    TotalKeys     int
+    TotalVersions int
+    MaxVersions   int // versions on the single most-written key
+    AvgVersions   float64
+    Tombstones    int // versions that record a delete
+}
+
+// Stats computes version counts in a single pass with every shard read-locked.
+func (store *MVCCStore) Stats() MVCCStats {
+    store.rLockAll()
+    defer store.rUnlockAll()
+
+    var stats MVCCStats
+    for i := range store.shards {
+        for _, entry := range store.shards[i].data {
+            entry.lock.RLock()
+            count := len(entry.versions)
+            for _, v := range entry.versions {
+                if v.deleted {
+                    stats.Tombstones++
+                }
+            }
+            entry.lock.RUnlock()
+
+            stats.TotalKeys++
+            stats.TotalVersions += count
+            if count > stats.MaxVersions {
+                stats.MaxVersions = count
+            }
+        }
+    }
+    if stats.TotalKeys > 0 {
+        stats.AvgVersions = float64(stats.TotalVersions) / float64(stats.TotalKeys)
+    }
+    return stats
+}
+
+// readLocked resolves entry at snapshotTime; the caller must hold its shard's
+// lock and entry.lock. A nil entry is a key that was never written.
+func (store *MVCCStore) readLocked(entry *keyEntry, snapshotTime int64) (int, bool) {
+    if entry == nil {
+        return 0, false
+    }
+    versions := entry.versions
+
+    // History before the GC horizon is gone, so fall back to the oldest retained version
+    if snapshotTime < store.gcHorizon {
+        snapshotTime = store.gcHorizon
+    }
+
+    // Versions are appended in timestamp order, so binary search for the
+    // first version newer than snapshotTime; the one before it is visible
+    i := sort.Search(len(versions), func(i int) bool {
+        return versions[i].timestamp > snapshotTime
+    }) - 1
+    if i < 0 || versions[i].deleted {
+        return 0, false
+    }
+    return versions[i].value, true
+}
+
+// readLinear is the original backward scan, kept to check and benchmark the
+// binary search against.
+func readLinear(versions []VersionedValue, snapshotTime int64) (int, bool) {
+    for i := len(versions) - 1; i >= 0; i-- {
+        if versions[i].timestamp <= snapshotTime {
+            if versions[i].deleted {
+                return 0, false
+            }
+            return versions[i].value, true
+        }
+    }
+    return 0, false
+}
+
+// RangeScan returns the value of every key in [start, end) visible at
+// snapshotTime. Every shard is read-locked for the whole scan, so no key is
+// added or garbage collected partway through.
+func (store *MVCCStore) RangeScan(start, end string, snapshotTime int64) map[string]int {
+    return store.scan(snapshotTime, func(key string, _ int) bool {
+        return key >= start && key < end
+    })
+}
+
+// Query returns every key whose value as of txTime satisfies pred, e.g.
+// every balance over 100. Like RangeScan it holds the read lock for the
+// whole scan, so all keys are judged against the same snapshot.
+func (store *MVCCStore) Query(txTime time.Time, pred func(key string, value int) bool) map[string]int {
+    return store.scan(txTime.UnixNano(), pred)
+}
+
+// scan resolves every key at snapshotTime and keeps those match accepts.
+func (store *MVCCStore) scan(snapshotTime int64, match func(key string, value int) bool) map[string]int {
+    store.rLockAll()
+    defer store.rUnlockAll()
+
+    result := make(map[string]int)
+    for i := range store.shards {
+        for key, entry := range store.shards[i].data {
+            entry.lock.RLock()
+            value, ok := store.readLocked(entry, snapshotTime)
+            entry.lock.RUnlock()
+            if ok && match(key, value) {
+                result[key] = value
+            }
+        }
+    }
+    return result
+}
+
+// ReadView is a fixed historical snapshot of the store; every read through
+// it resolves at the same point in time.
+type ReadView struct {
+    store    *MVCCStore
+    snapshot int64
+}
+
+// AsOf returns a read view of the store as it was at t, so callers can read
+// repeatedly without passing the timestamp each time and drifting.
+func (store *MVCCStore) AsOf(t time.Time) *ReadView {
+    return &ReadView{store: store, snapshot: t.UnixNano()}
+}
+
+func (view *ReadView) Get(key string) (int, bool) {
+    return view.store.Read(key, view.snapshot)
+}
+
+func (view *ReadView) Scan(start, end string) map[string]int {
+    return view.store.RangeScan(start, end, view.snapshot)
+}
+
+// BeginTx returns a snapshot ID; ReadAt with it sees every write made so far
+// and none made afterwards, regardless of clock resolution or skew. Taking
+// the commit lock exclusively waits out commits that are still appending.
+func (store *MVCCStore) BeginTx() uint64 {
+    store.commitLock.Lock()
+    defer store.commitLock.Unlock()
+    return atomic.LoadUint64(&store.txID)
+}
+
+func (store *MVCCStore) ReadAt(key string, snapshotTx uint64) (int, bool) {
+    var value int
+    var ok bool
+    store.readKey(context.Background(), key, func(entry *keyEntry) {
+        if entry == nil {
+            return
+        }
+        if snapshotTx < store.gcHorizonTx {
+            snapshotTx = store.gcHorizonTx
+        }
+
+        // Find the latest version whose txID is not newer than the snapshot
+        versions := entry.versions
+        for i := len(versions) - 1; i >= 0; i-- {
+            if versions[i].txID <= snapshotTx {
+                value, ok = versions[i].value, !versions[i].deleted
+                return
+            }
+        }
+    })
+    if !ok {
+        return 0, false
+    }
+    return value, true
+}
+
+var ErrTxDone = errors.New("transaction already committed or aborted")
+
+// Tx is a snapshot-isolated transaction: reads see the store as of Begin
+// plus the transaction's own writes, and writes are buffered until Commit.
+type Tx struct {
+    store    *MVCCStore
+    snapshot uint64
+    writes   map[string]int
+    reads    map[string]bool // keys read from the store, checked at Commit
+    readsMu  sync.Mutex      // guards reads, which other transactions' CommitSSI inspects
+    done     bool
+
+    // Serializable snapshot isolation bookkeeping, guarded by store.ssi.mu
+    commitTx    uint64 // transaction ID CommitSSI applied the writes under
+    inConflict  bool   // a concurrent transaction read something this one wrote
+    outConflict bool   // this transaction read something a concurrent one wrote
+}
+
+func (store *MVCCStore) Begin() *Tx {
+    store.ssi.mu.Lock()
+    defer store.ssi.mu.Unlock()
+
+    // Take the snapshot under the tracker lock, so no CommitSSI can land
+    // between the snapshot and the registration and go unnoticed
+    tx := &Tx{
+        store:    store,
+        snapshot: store.BeginTx(),
+        writes:   make(map[string]int),
+        reads:    make(map[string]bool),
+    }
+    store.ssi.active[tx] = true
+    return tx
+}
+
+func (tx *Tx) Read(key string) (int, bool) {
+    // Read your own writes first
+    if value, ok := tx.writes[key]; ok {
+        return value, true
+    }
+    tx.readsMu.Lock()
+    tx.reads[key] = true
+    tx.readsMu.Unlock()
+    return tx.store.ReadAt(key, tx.snapshot)
+}
+
+// ReadCommitted reads key as of right now instead of the transaction's
+// snapshot, modeling the read committed isolation level: each call sees
+// every write committed before it, so two calls can disagree. Keys read
+// this way are not validated at Commit.
+func (tx *Tx) ReadCommitted(key string) (int, bool) {
+    if value, ok := tx.writes[key]; ok {
+        return value, true
+    }
+    return tx.store.Read(key, time.Now().UnixNano())
+}
+
+func (tx *Tx) Write(key string, value int) {
+    tx.writes[key] = value
+}
+
+// ValidationError reports the keys a transaction read that another
+// transaction committed newer versions of after its snapshot.
+type ValidationError struct {
+    Keys []string
+}
+
+func (e *ValidationError) Error() string {
+    return fmt.Sprintf("validation failed: keys %v changed since snapshot", e.Keys)
+}
+
+// Commit validates and then applies every buffered write while holding the
+// lock of every shard it touches. The writes share one transaction ID, so
+// other transactions see all of them or none.
+// Validation is first-committer-wins: if any key the transaction read has a
+// version newer than its snapshot, the transaction aborts with a
+// ValidationError instead.
+func (tx *Tx) Commit() error {
+    return tx.commit(func() error {
+        return tx.changedSince(tx.reads)
+    })
+}
+
+// CommitSnapshot commits under plain snapshot isolation, which only rejects
+// write-write conflicts: the transaction fails if another one committed a
+// newer version of a key it wrote. Keys it only read may have changed, which
+// is what allows write skew.
+func (tx *Tx) CommitSnapshot() error {
+    written := make(map[string]bool, len(tx.writes))
+    for key := range tx.writes {
+        written[key] = true
+    }
+    return tx.commit(func() error {
+        return tx.changedSince(written)
+    })
+}
+
+// commit runs validate and, if it passes, applies the buffered writes, all
+// with the shards of every key involved locked.
+func (tx *Tx) commit(validate func() error) error {
+    if tx.done {
+        return ErrTxDone
+    }
+    tx.done = true
+    tx.store.ssi.finish(tx)
+
+    shards := tx.lockShards()
+    defer func() {
+        for _, i := range shards {
+            tx.store.shards[i].lock.Unlock()
+        }
+    }()
+
+    if err := validate(); err != nil {
+        tx.writes = nil
+        return err
+    }
+    tx.apply()
+    return nil
+}
+
+// apply appends every buffered write under one commit stamp and returns
+// its transaction ID; the caller must hold the shards of every written key.
+func (tx *Tx) apply() uint64 {
+    if len(tx.writes) == 0 {
+        return atomic.LoadUint64(&tx.store.txID)
+    }
+    stamp := tx.store.beginCommit()
+    defer tx.store.endCommit()
+    for key, value := range tx.writes {
+        tx.store.appendVersionLocked(tx.store.shardFor(key).entryLocked(key), stamp, value, false)
+    }
+    return stamp.txID
+}
+
+// changedSince returns a ValidationError listing the keys that have a
+// version newer than the snapshot; the caller must hold their shard locks.
+func (tx *Tx) changedSince(keys map[string]bool) error {
+    var conflicts []string
+    for key := range keys {
+        entry := tx.store.shardFor(key).data[key]
+        if entry == nil {
+            continue
+        }
+        if n := len(entry.versions); n > 0 && entry.versions[n-1].txID > tx.snapshot {
+            conflicts = append(conflicts, key)
+        }
+    }
+    if len(conflicts) > 0 {
+        sort.Strings(conflicts)
+        return &ValidationError{Keys: conflicts}
+    }
+    return nil
+}
+
+var ErrSerializationFailure = errors.New("could not serialize access due to read/write dependencies among transactions")
+
+// ssiTracker remembers the transactions that serializable snapshot
+// isolation must check a committing transaction against.
+type ssiTracker struct {
+    mu        sync.Mutex
+    active    map[*Tx]bool
+    committed []*Tx // committed with CommitSSI and possibly concurrent with an active transaction
+}
+
+// finish stops tracking tx as active.
+func (t *ssiTracker) finish(tx *Tx) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    delete(t.active, tx)
+}
+
+// CommitSSI commits under serializable snapshot isolation. On top of the
+// write-write check of CommitSnapshot, it tracks rw-antidependencies: T1 -rw-> T2
+// when T1 read a key that the concurrent T2 wrote, so T1 must come before T2 in
+// any serial order. A transaction with both an incoming and an outgoing edge
+// is the pivot of a dangerous structure that may not be serializable, and
+// rather than search for an actual cycle, the committing transaction aborts
+// with ErrSerializationFailure whenever it is, or would make a committed
+// transaction, such a pivot. Only transactions that all commit with
+// CommitSSI are protected from each other.
+func (tx *Tx) CommitSSI() error {
+    if tx.done {
+        return ErrTxDone
+    }
+    tx.done = true
+    store := tx.store
+
+    shards := tx.lockShards()
+    defer func() {
+        for _, i := range shards {
+            store.shards[i].lock.Unlock()
+        }
+    }()
+
+    store.ssi.mu.Lock()
+    defer store.ssi.mu.Unlock()
+    delete(store.ssi.active, tx)
+
+    written := make(map[string]bool, len(tx.writes))
+    for key := range tx.writes {
+        written[key] = true
+    }
+    if err := tx.changedSince(written); err != nil {
+        tx.writes = nil
+        return err
+    }
+
+    // Find the edges this commit would add. Active transactions' writes are
+    // still buffered, so only their reads can conflict with ours
+    in, out := tx.inConflict, tx.outConflict
+    var readers, writers []*Tx // concurrent transactions on each side of an edge with tx
+    for other := range store.ssi.active {
+        other.readsMu.Lock()
+        conflict := readsAny(other.reads, tx.writes)
+        other.readsMu.Unlock()
+        if conflict {
+            readers = append(readers, other)
+            in = true
+        }
+    }
+    for _, other := range store.ssi.committed {
+        if other.commitTx <= tx.snapshot {
+            continue // committed before our snapshot, so not concurrent
+        }
+        if readsAny(other.reads, tx.writes) {
+            readers = append(readers, other)
+            in = true
+            if other.inConflict {
+                tx.writes = nil
+                return ErrSerializationFailure
+            }
+        }
+        if readsAny(tx.reads, other.writes) {
+            writers = append(writers, other)
+            out = true
+            if other.outConflict {
+                tx.writes = nil
+                return ErrSerializationFailure
+            }
+        }
+    }
+    if in && out {
+        tx.writes = nil
+        return ErrSerializationFailure
+    }
+
+    for _, other := range readers {
+        other.outConflict = true
+    }
+    for _, other := range writers {
+        other.inConflict = true
+    }
+    tx.inConflict, tx.outConflict = in, out
+
+    tx.commitTx = tx.apply()
+    store.ssi.committed = append(store.ssi.committed, tx)
+    store.ssi.prune()
+    return nil
+}
+
+// readsAny reports whether any key in reads was written in writes.
+func readsAny(reads map[string]bool, writes map[string]int) bool {
+    for key := range writes {
+        if reads[key] {
+            return true
+        }
+    }
+    return false
+}
+
+// prune forgets committed transactions that no active transaction overlaps;
+// the caller must hold t.mu.
+func (t *ssiTracker) prune() {
+    oldest := uint64(math.MaxUint64)
+    for tx := range t.active {
+        if tx.snapshot < oldest {
+            oldest = tx.snapshot
+        }
+    }
+    kept := t.committed[:0]
+    for _, tx := range t.committed {
+        if tx.commitTx > oldest {
+            kept = append(kept, tx)
+        }
+    }
+    for i := len(kept); i < len(t.committed); i++ {
+        t.committed[i] = nil
+    }
+    t.committed = kept
+}
+
+// lockShards write-locks the shards of every key the transaction read or
+// wrote, in index order so concurrent commits can't deadlock, and returns
+// their indexes. Holding a shard exclusively also excludes every key lock
+// holder in it, since they hold the shard lock shared.
+func (tx *Tx) lockShards() []int {
+    seen := make(map[int]bool)
+    for key := range tx.reads {
+        seen[tx.store.shardIndex(key)] = true
+    }
+    for key := range tx.writes {
+        seen[tx.store.shardIndex(key)] = true
+    }
+    shards := make([]int, 0, len(seen))
+    for i := range seen {
+        shards = append(shards, i)
+    }
+    sort.Ints(shards)
+
+    for _, i := range shards {
+        tx.store.shards[i].lock.Lock()
+    }
+    return shards
 }
 
-func NewMVCCStore() *MVCCStore {
-    return &MVCCStore{
-        data: make(map[string][]VersionedValue),
+// Abort discards the buffered writes.
+func (tx *Tx) Abort() {
+    if !tx.done {
+        tx.store.ssi.finish(tx)
     }
+    tx.done = true
+    tx.writes = nil
 }
 
-func (store *MVCCStore) Write(key string, value int) {
-    store.lock.Lock()
-    defer store.lock.Unlock()
+// GarbageCollect drops versions older than before, keeping the newest version
+// visible at before so snapshots at or after the cutoff still read correctly.
+// Returns the number of versions reclaimed.
+func (store *MVCCStore) GarbageCollect(before time.Time) int {
+    store.lockAll()
+    defer store.unlockAll()
 
-    version := VersionedValue{
-        timestamp: time.Now().UnixNano(),
-        value:     value,
+    cutoff := before.UnixNano()
+    reclaimed := 0
+    for s := range store.shards {
+        reclaimed += store.collectShard(&store.shards[s], cutoff)
+    }
+
+    if cutoff > store.gcHorizon {
+        store.gcHorizon = cutoff
     }
-    store.data[key] = append(store.data[key], version)
+    return reclaimed
 }
 
-func (store *MVCCStore) Read(key string, snapshotTime int64) (int, bool) {
-    store.lock.RLock()
-    defer store.lock.RUnlock()
+// collectShard compacts one shard for GarbageCollect, which holds every lock.
+func (store *MVCCStore) collectShard(shard *mvccShard, before int64) int {
+    reclaimed := 0
+    for _, entry := range shard.data {
+        versions := entry.versions
+        // Index of the newest version not newer than before
+        keep := -1
+        for i := len(versions) - 1; i >= 0; i-- {
+            if versions[i].timestamp <= before {
+                keep = i
+                break
+            }
+        }
+        if keep < 0 {
+            continue
+        }
+        if versions[keep].txID > store.gcHorizonTx {
+            store.gcHorizonTx = versions[keep].txID
+        }
+        if keep == 0 {
+            continue
+        }
 
-    versions, exists := store.data[key]
-    if !exists {
-        return 0, false
+        // Compact in place and clear the tail so dropped versions can be freed
+        n := copy(versions, versions[keep:])
+        for i := n; i < len(versions); i++ {
+            versions[i] = VersionedValue{}
+        }
+        entry.versions = versions[:n]
+        reclaimed += keep
     }
+    return reclaimed
+}
 
-    // Find the latest version not newer than snapshotTime
-    for i := len(versions) - 1; i >= 0; i-- {
-        if versions[i].timestamp <= snapshotTime {
-            return versions[i].value, true
+// snapshotFile is the JSON layout written by Snapshot and read by Load.
+type snapshotFile struct {
+    TxID        uint64                       `json:"tx_id"`
+    GCHorizon   int64                        `json:"gc_horizon"`
+    GCHorizonTx uint64                       `json:"gc_horizon_tx"`
+    Keys        map[string][]snapshotVersion `json:"keys"`
+}
+
+type snapshotVersion struct {
+    TxID      uint64 `json:"tx_id"`
+    Timestamp int64  `json:"timestamp"`
+    Value     int    `json:"value"`
+    Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// Snapshot writes the full version history to w, oldest version first per key.
+func (store *MVCCStore) Snapshot(w io.Writer) error {
+    // Exclusive, unlike the other whole-store reads, so no key is written
+    // partway through and the snapshot is a single point in time
+    store.lockAll()
+    defer store.unlockAll()
+
+    file := snapshotFile{
+        TxID:        atomic.LoadUint64(&store.txID),
+        GCHorizon:   store.gcHorizon,
+        GCHorizonTx: store.gcHorizonTx,
+        Keys:        make(map[string][]snapshotVersion),
+    }
+    for s := range store.shards {
+        for key, entry := range store.shards[s].data {
+            saved := make([]snapshotVersion, len(entry.versions))
+            for i, v := range entry.versions {
+                saved[i] = snapshotVersion{TxID: v.txID, Timestamp: v.timestamp, Value: v.value, Deleted: v.deleted}
+            }
+            file.Keys[key] = saved
         }
     }
-    return 0, false
+    return json.NewEncoder(w).Encode(file)
+}
+
+// Load replaces the store's contents with a history written by Snapshot.
+// The store is left untouched if the input is malformed.
+func (store *MVCCStore) Load(r io.Reader) error {
+    var file snapshotFile
+    if err := json.NewDecoder(r).Decode(&file); err != nil {
+        return fmt.Errorf("decoding snapshot: %w", err)
+    }
+
+    data := make([]map[string]*keyEntry, len(store.shards))
+    for i := range data {
+        data[i] = make(map[string]*keyEntry)
+    }
+    for key, saved := range file.Keys {
+        versions := make([]VersionedValue, len(saved))
+        for i, v := range saved {
+            if v.TxID > file.TxID {
+                return fmt.Errorf("corrupt snapshot: key %q has txID %d beyond last txID %d", key, v.TxID, file.TxID)
+            }
+            if i > 0 && (v.TxID <= saved[i-1].TxID || v.Timestamp < saved[i-1].Timestamp) {
+                return fmt.Errorf("corrupt snapshot: versions of key %q are out of order", key)
+            }
+            versions[i] = VersionedValue{txID: v.TxID, timestamp: v.Timestamp, value: v.Value, deleted: v.Deleted}
+        }
+        data[store.shardIndex(key)][key] = &keyEntry{versions: versions}
+    }
+
+    store.lockAll()
+    defer store.unlockAll()
+
+    for i := range store.shards {
+        store.shards[i].data = data[i]
+    }
+    atomic.StoreUint64(&store.txID, file.TxID)
+    store.gcHorizon = file.GCHorizon
+    store.gcHorizonTx = file.GCHorizonTx
+    store.notifyWrite()
+    return nil
+}
+
+func garbageCollectionExample() {
+    store := NewMVCCStore()
+
+    // Write 100 versions and remember when each one was written
+    timestamps := make([]int64, 100)
+    for i := 0; i < 100; i++ {
+        store.Write("y", i)
+        timestamps[i] = store.shardFor("y").data["y"].versions[i].timestamp
+    }
+
+    // Collect the first half of the history
+    reclaimed := store.GarbageCollect(time.Unix(0, timestamps[49]))
+    fmt.Println("GC reclaimed", reclaimed, "versions,", store.VersionCount("y"), "retained")
+
+    // Reads at retained timestamps still succeed
+    for _, i := range []int{49, 75, 99} {
+        value, ok := store.Read("y", timestamps[i])
+        fmt.Printf("Read y at version %d = %d (found: %v)\n", i, value, ok)
+        if !ok || value != i {
+            log.Fatalf("read y at retained version %d = %d (found: %v)", i, value, ok)
+        }
+    }
+
+    // A read older than the cutoff falls back to the oldest retained version
+    oldest := store.shardFor("y").data["y"].versions[0].value
+    value, ok := store.Read("y", timestamps[10])
+    fmt.Printf("Read y at collected version 10 = %d (found: %v)\n", value, ok)
+    if !ok || value != oldest {
+        log.Fatalf("read y below the cutoff = %d (found: %v), want the oldest retained version %d", value, ok, oldest)
+    }
+}
+
+func deleteExample() {
+    store := NewMVCCStore()
+
+    store.Write("z", 1)
+    beforeDelete := store.BeginTx()
+    store.Delete("z")
+    afterDelete := store.BeginTx()
+
+    value, ok := store.ReadAt("z", beforeDelete)
+    fmt.Printf("Read z before delete = %d (found: %v)\n", value, ok)
+    if !ok || value != 1 {
+        log.Fatalf("read z before delete = %d (found: %v), want 1", value, ok)
+    }
+    value, ok = store.ReadAt("z", afterDelete)
+    fmt.Printf("Read z after delete = %d (found: %v)\n", value, ok)
+    if ok {
+        log.Fatal("read z after delete found the deleted value")
+    }
+
+    // Writing again resurrects the key
+    store.Write("z", 2)
+    value, ok = store.ReadAt("z", store.BeginTx())
+    fmt.Printf("Read z after rewrite = %d (found: %v)\n", value, ok)
+    if !ok || value != 2 {
+        log.Fatalf("read z after rewrite = %d (found: %v), want 2", value, ok)
+    }
+}
+
+func transactionIDExample() {
+    store := NewMVCCStore()
+
+    // Two writes with no sleep between them may share a wall-clock timestamp,
+    // but transaction IDs still order them deterministically
+    store.Write("w", 1)
+    snapshot := store.BeginTx()
+    store.Write("w", 2)
+
+    value, _ := store.ReadAt("w", snapshot)
+    fmt.Println("Snapshot", snapshot, "reads w =", value)
+    if value != 1 {
+        log.Fatalf("snapshot %d reads w = %d, want 1", snapshot, value)
+    }
+    value, _ = store.ReadAt("w", store.BeginTx())
+    fmt.Println("Snapshot", store.BeginTx(), "reads w =", value)
+    if value != 2 {
+        log.Fatalf("snapshot %d reads w = %d, want 2", store.BeginTx(), value)
+    }
+}
+
+// snapshotNow returns a time that sees every write made before the call and
+// none made after it. It waits for the clock to move past the time it
+// returns, so even a coarse clock can't give a later write the same
+// timestamp.
+func snapshotNow() time.Time {
+    t := time.Now()
+    for time.Now().UnixNano() <= t.UnixNano() {
+    }
+    return t
+}
+
+func rangeScanExample() {
+    store := NewMVCCStore()
+
+    for i, key := range []string{"a", "b", "c", "d", "e"} {
+        store.Write(key, i)
+    }
+    snapshot := snapshotNow().UnixNano()
+
+    // Later writes are invisible to the snapshot
+    store.Write("b", 100)
+    store.Write("f", 5)
+
+    atSnapshot := store.RangeScan("a", "z", snapshot)
+    now := store.RangeScan("a", "z", snapshotNow().UnixNano())
+    fmt.Println("Scan [a, z) at snapshot:", atSnapshot)
+    fmt.Println("Scan [a, z) now:", now)
+    if want := map[string]int{"a": 0, "b": 1, "c": 2, "d": 3, "e": 4}; !maps.Equal(atSnapshot, want) {
+        log.Fatalf("scan at snapshot = %v, want %v", atSnapshot, want)
+    }
+    if want := map[string]int{"a": 0, "b": 100, "c": 2, "d": 3, "e": 4, "f": 5}; !maps.Equal(now, want) {
+        log.Fatalf("scan now = %v, want %v", now, want)
+    }
+}
+
+func queryExample() {
+    store := NewMVCCStore()
+    for account, balance := range map[string]int{"alice": 50, "bob": 150, "carol": 300, "dave": 90} {
+        store.Write(account, balance)
+    }
+    snapshot := snapshotNow()
+
+    // Dave crosses the threshold and Carol drops below it after the snapshot
+    store.Write("dave", 200)
+    store.Write("carol", 20)
+
+    over100 := func(_ string, balance int) bool { return balance > 100 }
+    atSnapshot, now := store.Query(snapshot, over100), store.Query(snapshotNow(), over100)
+    fmt.Println("Balances > 100 at snapshot:", atSnapshot)
+    fmt.Println("Balances > 100 now:", now)
+    if want := map[string]int{"bob": 150, "carol": 300}; !maps.Equal(atSnapshot, want) {
+        log.Fatalf("balances > 100 at snapshot = %v, want %v", atSnapshot, want)
+    }
+    if want := map[string]int{"bob": 150, "dave": 200}; !maps.Equal(now, want) {
+        log.Fatalf("balances > 100 now = %v, want %v", now, want)
+    }
+}
+
+func conflictExample() {
+    store := NewMVCCStore()
+    store.Write("balance", 100)
+
+    // Two transactions read the same snapshot
+    snapshot := time.Now().UnixNano()
+    value, _ := store.Read("balance", snapshot)
+
+    err := store.WriteIfUnchanged("balance", value+10, snapshot)
+    fmt.Println("First writer:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+    err = store.WriteIfUnchanged("balance", value+20, snapshot)
+    fmt.Println("Second writer:", err)
+    if err == nil {
+        log.Fatal("second writer overwrote the first from the same snapshot")
+    }
+}
+
+func persistenceExample() {
+    store := NewMVCCStore()
+    store.Write("p", 1)
+    historical := time.Now().UnixNano()
+    store.Write("p", 2)
+
+    var buf bytes.Buffer
+    if err := store.Snapshot(&buf); err != nil {
+        fmt.Println("Snapshot failed:", err)
+        return
+    }
+
+    restored := NewMVCCStore()
+    if err := restored.Load(&buf); err != nil {
+        fmt.Println("Load failed:", err)
+        return
+    }
+    before, _ := store.Read("p", historical)
+    after, _ := restored.Read("p", historical)
+    fmt.Println("Historical read of p before/after round trip:", before, after)
+    if before != 1 || after != 1 {
+        log.Fatalf("historical read of p before/after round trip = %d, %d; want 1", before, after)
+    }
+
+    err := restored.Load(bytes.NewBufferString(`{"keys": {"p": [`))
+    fmt.Println("Loading corrupt input:", err)
+    if err == nil {
+        log.Fatal("corrupt input loaded without an error")
+    }
+}
+
+func snapshotIsolationExample() {
+    store := NewMVCCStore()
+    store.Write("k", 1)
+
+    tx := store.Begin()
+    tx.Write("k", 2)
+    value, _ := tx.Read("k")
+    fmt.Println("Tx reads its own write k =", value)
+    if value != 2 {
+        log.Fatalf("tx reads its own write k = %d, want 2", value)
+    }
+
+    // A concurrent commit after Begin is invisible to the snapshot
+    store.Write("other", 10)
+    _, ok := tx.Read("other")
+    fmt.Println("Tx sees key committed after Begin:", ok)
+    if ok {
+        log.Fatal("tx saw a key committed after Begin")
+    }
+    tx.Commit()
+
+    before, _ := store.ReadAt("k", store.BeginTx())
+    aborted := store.Begin()
+    aborted.Write("k", 99)
+    aborted.Abort()
+    value, _ = store.ReadAt("k", store.BeginTx())
+    fmt.Println("After abort, k =", value)
+    if value != before {
+        log.Fatalf("after abort, k = %d, want %d", value, before)
+    }
+}
+
+// atomicCommitExample moves money between accounts in concurrent
+// transactions while other transactions sum every balance from their
+// snapshot. A commit is all or nothing, so every sum must come out the same.
+func atomicCommitExample() {
+    const accounts, balance = 10, 100
+    store := NewMVCCStore()
+    for i := 0; i < accounts; i++ {
+        store.Write(fmt.Sprintf("account-%d", i), balance)
+    }
+
+    var transfers, sums, torn int64
+    var wg sync.WaitGroup
+    stop := make(chan struct{})
+    for g := 0; g < 4; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            rng := rand.New(rand.NewSource(int64(g)))
+            for i := 0; i < 500; i++ {
+                from, to := fmt.Sprintf("account-%d", rng.Intn(accounts)), fmt.Sprintf("account-%d", rng.Intn(accounts))
+                if from == to {
+                    continue
+                }
+                tx := store.Begin()
+                a, _ := tx.Read(from)
+                b, _ := tx.Read(to)
+                tx.Write(from, a-1)
+                tx.Write(to, b+1)
+                if tx.Commit() == nil {
+                    atomic.AddInt64(&transfers, 1)
+                }
+            }
+        }(g)
+    }
+    var readers sync.WaitGroup
+    for g := 0; g < 2; g++ {
+        readers.Add(1)
+        go func() {
+            defer readers.Done()
+            for {
+                select {
+                case <-stop:
+                    return
+                default:
+                }
+                tx := store.Begin()
+                sum := 0
+                for i := 0; i < accounts; i++ {
+                    v, _ := tx.Read(fmt.Sprintf("account-%d", i))
+                    sum += v
+                }
+                tx.Abort()
+                atomic.AddInt64(&sums, 1)
+                if sum != accounts*balance {
+                    atomic.AddInt64(&torn, 1)
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    close(stop)
+    readers.Wait()
+
+    fmt.Printf("Atomic commits: %d transfers, %d of %d snapshot sums torn\n", transfers, torn, sums)
+    if torn > 0 {
+        log.Fatalf("a snapshot saw part of a commit: %d torn sums", torn)
+    }
+}
+
+func versionLimitExample() {
+    store := NewMVCCStoreWithLimit(5)
+    for i := 0; i < 20; i++ {
+        store.Write("v", i)
+    }
+
+    oldest := store.shardFor("v").data["v"].versions[0].value
+    value, _ := store.Latest("v")
+    fmt.Println("With a limit of 5:", store.VersionCount("v"), "versions kept, oldest =", oldest, "latest =", value)
+    if store.VersionCount("v") != 5 || oldest != 15 || value != 19 {
+        log.Fatalf("with a limit of 5: %d versions kept, oldest = %d, latest = %d; want 5 kept from 15 to 19",
+            store.VersionCount("v"), oldest, value)
+    }
+}
+
+func contextExample() {
+    store := NewMVCCStore()
+
+    // A cancelled context returns without writing
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    err := store.WriteCtx(ctx, "c", 1)
+    fmt.Println("WriteCtx with cancelled context:", err, "- versions written:", store.VersionCount("c"))
+    if !errors.Is(err, context.Canceled) || store.VersionCount("c") != 0 {
+        log.Fatalf("WriteCtx with a cancelled context returned %v and wrote %d versions", err, store.VersionCount("c"))
+    }
+
+    // A reader stuck behind a long write gives up at its deadline
+    shard := store.shardFor("c")
+    shard.lock.Lock()
+    ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    _, _, err = store.ReadCtx(ctx, "c", time.Now().UnixNano())
+    fmt.Printf("ReadCtx behind a held write lock: %v after %v\n", err, time.Since(start).Round(10*time.Millisecond))
+    shard.lock.Unlock()
+    if !errors.Is(err, context.DeadlineExceeded) {
+        log.Fatalf("ReadCtx behind a held write lock returned %v, want %v", err, context.DeadlineExceeded)
+    }
+}
+
+func validationExample() {
+    store := NewMVCCStore()
+    store.Write("seats", 10)
+
+    // Both transactions read the same key from the same snapshot
+    tx1 := store.Begin()
+    tx2 := store.Begin()
+    seats1, _ := tx1.Read("seats")
+    seats2, _ := tx2.Read("seats")
+    tx1.Write("seats", seats1-1)
+    tx2.Write("seats", seats2-1)
+
+    err1, err2 := tx1.Commit(), tx2.Commit()
+    fmt.Println("First committer:", err1)
+    fmt.Println("Second committer:", err2)
+    if err1 != nil || err2 == nil {
+        log.Fatalf("want only the second committer to fail, got %v / %v", err1, err2)
+    }
+}
+
+func latestExample() {
+    store := NewMVCCStore()
+    store.Write("l", 1)
+    store.Write("l", 2)
+
+    value, ok := store.Latest("l")
+    fmt.Printf("Latest l = %d (found: %v)\n", value, ok)
+    if !ok || value != 2 {
+        log.Fatalf("latest l = %d (found: %v), want 2", value, ok)
+    }
+    _, ok = store.Latest("missing")
+    fmt.Println("Latest of unknown key found:", ok)
+    if ok {
+        log.Fatal("found a key that was never written")
+    }
+}
+
+func statsExample() {
+    store := NewMVCCStore()
+
+    // One hot key and a few cold ones
+    for i := 0; i < 50; i++ {
+        store.Write("hot", i)
+    }
+    for _, key := range []string{"cold1", "cold2", "cold3", "cold4"} {
+        store.Write(key, 0)
+    }
+    store.Delete("cold4")
+    stats := store.Stats()
+    fmt.Printf("Stats before GC: %+v\n", stats)
+    if want := (MVCCStats{TotalKeys: 5, TotalVersions: 55, MaxVersions: 50, AvgVersions: 11, Tombstones: 1}); stats != want {
+        log.Fatalf("stats before GC = %+v, want %+v", stats, want)
+    }
+
+    // GC keeps one version per key, the tombstone included
+    store.GarbageCollect(snapshotNow())
+    stats = store.Stats()
+    fmt.Printf("Stats after GC: %+v\n", stats)
+    if want := (MVCCStats{TotalKeys: 5, TotalVersions: 5, MaxVersions: 1, AvgVersions: 1, Tombstones: 1}); stats != want {
+        log.Fatalf("stats after GC = %+v, want %+v", stats, want)
+    }
+}
+
+func binarySearchExample() {
+    store := NewMVCCStore()
+    for i := 0; i < 10000; i++ {
+        store.Write("hot", i)
+    }
+    versions := store.shardFor("hot").data["hot"].versions
+    first, last := versions[0].timestamp, versions[len(versions)-1].timestamp
+
+    // Both searches must agree on every snapshot, including ones before the first write
+    rng := rand.New(rand.NewSource(1))
+    queries := make([]int64, 1000)
+    mismatches := 0
+    for i := range queries {
+        queries[i] = first - 10 + rng.Int63n(last-first+20)
+        binValue, binOk := store.Read("hot", queries[i])
+        linValue, linOk := readLinear(versions, queries[i])
+        if binValue != linValue || binOk != linOk {
+            mismatches++
+        }
+    }
+    fmt.Println("Binary vs linear mismatches:", mismatches)
+    if mismatches != 0 {
+        log.Fatalf("binary and linear search disagree on %d snapshots", mismatches)
+    }
+
+    start := time.Now()
+    for _, q := range queries {
+        readLinear(versions, q)
+    }
+    linear := time.Since(start) / time.Duration(len(queries))
+    start = time.Now()
+    for _, q := range queries {
+        store.Read("hot", q)
+    }
+    binary := time.Since(start) / time.Duration(len(queries))
+    fmt.Printf("Read with 10,000 versions: linear %v/op, binary %v/op\n", linear, binary)
+}
+
+// visibilityOp is one write in a generated history.
+type visibilityOp struct {
+    key       string
+    timestamp int64
+    value     int
+    deleted   bool
+}
+
+// checkVisibility loads history into a store with the given number of
+// shards and checks Read against a reference that scans the whole history
+// for the last write to the key at or before the snapshot. History is
+// loaded through Load rather than written with Write so the timestamps are
+// under our control, duplicates included. Every key is probed at every
+// timestamp in the history, one either side of it, and before and after
+// all of them.
+func checkVisibility(history []visibilityOp, shards int) error {
+    file := snapshotFile{Keys: make(map[string][]snapshotVersion)}
+    probes := map[int64]bool{0: true, math.MaxInt64: true}
+    keys := map[string]bool{"never-written": true}
+    for _, op := range history {
+        file.TxID++
+        file.Keys[op.key] = append(file.Keys[op.key], snapshotVersion{
+            TxID: file.TxID, Timestamp: op.timestamp, Value: op.value, Deleted: op.deleted,
+        })
+        probes[op.timestamp-1], probes[op.timestamp], probes[op.timestamp+1] = true, true, true
+        keys[op.key] = true
+    }
+    var buf bytes.Buffer
+    if err := json.NewEncoder(&buf).Encode(file); err != nil {
+        return err
+    }
+    store := newShardedMVCCStore(shards)
+    if err := store.Load(&buf); err != nil {
+        return err
+    }
+
+    for key := range keys {
+        for t := range probes {
+            want, wantOk := 0, false
+            for _, op := range history {
+                if op.key != key || op.timestamp > t {
+                    continue
+                }
+                if op.deleted {
+                    want, wantOk = 0, false
+                } else {
+                    want, wantOk = op.value, true
+                }
+            }
+            got, ok := store.Read(key, t)
+            if got != want || ok != wantOk {
+                return fmt.Errorf("Read(%q, %d) = %d, %v; reference says %d, %v", key, t, got, ok, want, wantOk)
+            }
+        }
+    }
+    return nil
+}
+
+// randomHistory writes n random ops over a few keys, including the empty
+// key. Timestamps never go backwards but often repeat.
+func randomHistory(rng *rand.Rand, n int) []visibilityOp {
+    keys := []string{"", "a", "b", "c"}
+    history := make([]visibilityOp, n)
+    t := int64(1000)
+    for i := range history {
+        t += rng.Int63n(3)
+        history[i] = visibilityOp{
+            key:       keys[rng.Intn(len(keys))],
+            timestamp: t,
+            value:     rng.Intn(100),
+            deleted:   rng.Intn(5) == 0,
+        }
+    }
+    return history
+}
+
+// fuzzVisibilityExample runs checkVisibility over a fixed corpus of edge
+// cases and then many random histories, guarding the binary search and the
+// sharding against a regression.
+func fuzzVisibilityExample() {
+    failures := 0
+    corpus := map[string][]visibilityOp{
+        "no writes":      nil,
+        "empty key":      {{key: "", timestamp: 10, value: 1}},
+        "single version": {{key: "a", timestamp: 10, value: 1}},
+        "duplicate timestamps": {
+            {key: "a", timestamp: 10, value: 1},
+            {key: "a", timestamp: 10, value: 2},
+            {key: "b", timestamp: 10, value: 3},
+            {key: "a", timestamp: 11, deleted: true},
+            {key: "a", timestamp: 11, value: 4},
+        },
+    }
+    for name, history := range corpus {
+        if err := checkVisibility(history, 4); err != nil {
+            fmt.Printf("Visibility corpus %q failed: %v\n", name, err)
+            failures++
+        }
+    }
+
+    for seed := int64(0); seed < 300; seed++ {
+        rng := rand.New(rand.NewSource(seed))
+        shards := []int{1, 4, 16}[rng.Intn(3)]
+        if err := checkVisibility(randomHistory(rng, 1+rng.Intn(60)), shards); err != nil {
+            fmt.Printf("Visibility seed %d failed: %v\n", seed, err)
+            failures++
+        }
+    }
+    fmt.Printf("Visibility check: %d corpus cases and 300 random histories, %d failures\n", len(corpus), failures)
+    if failures != 0 {
+        log.Fatalf("%d visibility checks failed", failures)
+    }
+}
+
+// concurrentReads runs goroutines that each read the key at its index in
+// keys, reads times over, and returns the overall reads per second.
+func concurrentReads(store *MVCCStore, keys []string, goroutines, reads int) float64 {
+    var wg sync.WaitGroup
+    wg.Add(goroutines)
+    start := time.Now()
+    for g := 0; g < goroutines; g++ {
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < reads; i++ {
+                store.Latest(keys[(g*reads+i)%len(keys)])
+            }
+        }(g)
+    }
+    wg.Wait()
+    return float64(goroutines*reads) / time.Since(start).Seconds()
+}
+
+func shardingExample() {
+    keys := make([]string, 1000)
+    for i := range keys {
+        keys[i] = fmt.Sprintf("key-%d", i)
+    }
+
+    // The same writes must read back the same way however the keys are split
+    global, sharded := newShardedMVCCStore(1), newShardedMVCCStore(defaultShards)
+    rng := rand.New(rand.NewSource(1))
+    var snapshots []uint64
+    for i := 0; i < 5000; i++ {
+        key, value := keys[rng.Intn(len(keys))], rng.Intn(100)
+        if rng.Intn(10) == 0 {
+            global.Delete(key)
+            sharded.Delete(key)
+        } else {
+            global.Write(key, value)
+            sharded.Write(key, value)
+        }
+        if i%500 == 0 {
+            snapshots = append(snapshots, global.BeginTx())
+        }
+    }
+    mismatches := 0
+    for _, snapshot := range snapshots {
+        for _, key := range keys {
+            v1, ok1 := global.ReadAt(key, snapshot)
+            v2, ok2 := sharded.ReadAt(key, snapshot)
+            if v1 != v2 || ok1 != ok2 {
+                mismatches++
+            }
+        }
+    }
+    fmt.Println("Sharded vs single-lock mismatches:", mismatches)
+    if mismatches != 0 {
+        log.Fatalf("sharded and single-lock stores disagree on %d reads", mismatches)
+    }
+
+    for _, n := range []int{1, defaultShards} {
+        store := newShardedMVCCStore(n)
+        for _, key := range keys {
+            store.Write(key, 1)
+        }
+        fmt.Printf("Concurrent reads with %d shard(s): %.0f reads/sec\n", n, concurrentReads(store, keys, 32, 20000))
+    }
+}
+
+// concurrentWrites has each goroutine write its own key writes times and
+// returns the overall writes per second. A non-nil global mutex is held
+// around every write, standing in for a store with one lock for all keys.
+func concurrentWrites(store *MVCCStore, goroutines, writes int, global *sync.Mutex) float64 {
+    var wg sync.WaitGroup
+    wg.Add(goroutines)
+    start := time.Now()
+    for g := 0; g < goroutines; g++ {
+        go func(key string) {
+            defer wg.Done()
+            for i := 0; i < writes; i++ {
+                if global != nil {
+                    global.Lock()
+                }
+                store.Write(key, i)
+                if global != nil {
+                    global.Unlock()
+                }
+            }
+        }(fmt.Sprintf("writer-%d", g))
+    }
+    wg.Wait()
+    return float64(goroutines*writes) / time.Since(start).Seconds()
+}
+
+func keyLockingExample() {
+    // Two writers hammering different keys in the same shard
+    store := newShardedMVCCStore(1)
+    var wg sync.WaitGroup
+    for _, key := range []string{"left", "right"} {
+        wg.Add(1)
+        go func(key string) {
+            defer wg.Done()
+            for i := 0; i < 10000; i++ {
+                store.Write(key, i)
+            }
+        }(key)
+    }
+    wg.Wait()
+    left, _ := store.Latest("left")
+    right, _ := store.Latest("right")
+    fmt.Println("Versions of left/right:", store.VersionCount("left"), store.VersionCount("right"), "latest:", left, right)
+    if left != 9999 || right != 9999 {
+        log.Fatalf("latest left/right = %d, %d; want 9999", left, right)
+    }
+
+    fmt.Printf("Writes to distinct keys, one lock: %.0f writes/sec\n",
+        concurrentWrites(newShardedMVCCStore(1), 8, 10000, &sync.Mutex{}))
+    fmt.Printf("Writes to distinct keys, key locks: %.0f writes/sec\n",
+        concurrentWrites(newShardedMVCCStore(1), 8, 10000, nil))
+}
+
+func historyExample() {
+    store := NewMVCCStore()
+    for _, value := range []int{1, 2, 3} {
+        store.Write("h", value)
+    }
+    store.Delete("h")
+
+    history := store.History("h")
+    for _, v := range history {
+        fmt.Printf("h at %d = %d (deleted: %v)\n", v.Timestamp(), v.Value(), v.Deleted())
+    }
+    if len(history) != 4 {
+        log.Fatalf("history of h has %d versions, want 4", len(history))
+    }
+    for i, v := range history {
+        if wantDeleted := i == 3; v.Deleted() != wantDeleted || (!wantDeleted && v.Value() != i+1) {
+            log.Fatalf("version %d of h = %d (deleted: %v), want writes 1, 2, 3 then a delete", i, v.Value(), v.Deleted())
+        }
+        if i > 0 && v.Timestamp() < history[i-1].Timestamp() {
+            log.Fatalf("history of h is not oldest first: %d after %d", v.Timestamp(), history[i-1].Timestamp())
+        }
+    }
+    fmt.Println("History of unknown key:", store.History("missing"))
+    if len(store.History("missing")) != 0 {
+        log.Fatal("unknown key has a history")
+    }
+}
+
+func timelineExample() {
+    store := NewMVCCStore()
+    for _, value := range []int{100, 120, 90} {
+        store.Write("price", value)
+        time.Sleep(2 * time.Millisecond)
+    }
+    store.Delete("price")
+    timeline := store.Timeline("price")
+    fmt.Print("Timeline of price:\n", timeline)
+
+    // One line per version, oldest first, each later than the one before
+    lines := strings.Split(strings.TrimSuffix(timeline, "\n"), "\n")
+    want := []string{"100", "120", "90", "(deleted)"}
+    if len(lines) != len(want) {
+        log.Fatalf("timeline has %d lines, want %d", len(lines), len(want))
+    }
+    var last time.Duration
+    for i, line := range lines {
+        offset, value, _ := strings.Cut(line, " | ")
+        d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(offset, "+")))
+        if err != nil || value != want[i] || (i == 0 && d != 0) || (i > 0 && d <= last) {
+            log.Fatalf("timeline line %d = %q, want %s later than %v", i, line, want[i], last)
+        }
+        last = d
+    }
+}
+
+func readCommittedExample() {
+    store := NewMVCCStore()
+    store.Write("rc", 1)
+
+    tx := store.Begin()
+    first, _ := tx.ReadCommitted("rc")
+    snapshotFirst, _ := tx.Read("rc")
+
+    // Another writer commits between the transaction's statements
+    done := make(chan struct{})
+    go func() {
+        store.Write("rc", 2)
+        close(done)
+    }()
+    <-done
+
+    second, _ := tx.ReadCommitted("rc")
+    snapshotSecond, _ := tx.Read("rc")
+    fmt.Println("ReadCommitted before/after concurrent write:", first, second)
+    fmt.Println("Snapshot Read before/after concurrent write:", snapshotFirst, snapshotSecond)
+    if first != 1 || second != 2 || snapshotFirst != 1 || snapshotSecond != 1 {
+        log.Fatalf("ReadCommitted read %d, %d and snapshot Read %d, %d; want 1, 2 and 1, 1",
+            first, second, snapshotFirst, snapshotSecond)
+    }
+    tx.Abort()
+}
+
+func asOfExample() {
+    store := NewMVCCStore()
+    store.Write("price", 100)
+    store.Write("stock", 5)
+    view := store.AsOf(snapshotNow())
+
+    store.Write("price", 120)
+    store.Delete("stock")
+
+    price, _ := view.Get("price")
+    _, inStock := view.Get("stock")
+    scan := view.Scan("a", "z")
+    fmt.Println("View after later writes: price =", price, "stock present:", inStock, "scan:", scan)
+    if want := map[string]int{"price": 100, "stock": 5}; price != 100 || !inStock || !maps.Equal(scan, want) {
+        log.Fatalf("view after later writes: price = %d, stock present: %v, scan: %v; want the view to stay at %v",
+            price, inStock, scan, want)
+    }
+    price, _ = store.Latest("price")
+    fmt.Println("Latest price:", price)
+    if price != 120 {
+        log.Fatalf("latest price = %d, want 120", price)
+    }
+}
+
+func readAfterExample() {
+    store := NewMVCCStore()
+    store.Write("temp", 20)
+
+    // Ask for a version newer than any written so far; the writer produces it later
+    minTime := time.Unix(0, store.History("temp")[0].Timestamp()+1)
+    type readResult struct {
+        value int
+        err   error
+    }
+    result := make(chan readResult)
+    go func() {
+        value, err := store.ReadAfter("temp", minTime)
+        result <- readResult{value, err}
+    }()
+    time.Sleep(50 * time.Millisecond)
+    store.Write("temp", 25)
+    r := <-result
+    fmt.Println("ReadAfter unblocked with:", r.value, r.err)
+    if r.value != 25 || r.err != nil {
+        log.Fatalf("ReadAfter returned %d, %v; want the later version 25", r.value, r.err)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    _, err := store.ReadAfterCtx(ctx, "temp", time.Now().Add(time.Hour))
+    fmt.Println("ReadAfterCtx with no new version:", err)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        log.Fatalf("ReadAfterCtx with no new version returned %v, want %v", err, context.DeadlineExceeded)
+    }
+}
+
+func ssiExample() {
+    // Write skew is shown by writeSkewExample; transactions that don't read
+    // each other's writes commit normally
+    store := NewMVCCStore()
+    tx1, tx2 := store.Begin(), store.Begin()
+    tx1.Read("carol")
+    tx1.Write("carol", 1)
+    tx2.Read("dave")
+    tx2.Write("dave", 1)
+    err1, err2 := tx1.CommitSSI(), tx2.CommitSSI()
+    fmt.Println("Independent transactions under SSI:", err1, err2)
+    if err1 != nil || err2 != nil {
+        log.Fatalf("independent transactions failed under SSI: %v / %v", err1, err2)
+    }
 }
 
 func main() {
@@ -69,4 +1995,30 @@ func main() {
     // Transaction 2 reads
     value, _ = store.Read("x", tx2Time)
     fmt.Println("Transaction 2 reads x =", value)
+
+    garbageCollectionExample()
+    deleteExample()
+    transactionIDExample()
+    rangeScanExample()
+    queryExample()
+    conflictExample()
+    persistenceExample()
+    snapshotIsolationExample()
+    atomicCommitExample()
+    versionLimitExample()
+    contextExample()
+    validationExample()
+    latestExample()
+    statsExample()
+    binarySearchExample()
+    fuzzVisibilityExample()
+    shardingExample()
+    keyLockingExample()
+    historyExample()
+    timelineExample()
+    readCommittedExample()
+    asOfExample()
+    readAfterExample()
+    writeSkewExample()
+    ssiExample()
 }
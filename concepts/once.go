@@ -0,0 +1,57 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+type Resource struct {
+    createdAt time.Time
+}
+
+// LazyResource builds its Resource on the first Get, exactly once, no
+// matter how many goroutines call Get at the same time.
+type LazyResource struct {
+    once      sync.Once
+    resource  *Resource
+    initCount int32 // how many times init ran, for demonstration
+}
+
+func (l *LazyResource) Get() *Resource {
+    l.once.Do(func() {
+        atomic.AddInt32(&l.initCount, 1)
+        time.Sleep(10 * time.Millisecond) // Simulate expensive setup
+        l.resource = &Resource{createdAt: time.Now()}
+    })
+    return l.resource
+}
+
+func main() {
+    var lazy LazyResource
+    var wg sync.WaitGroup
+    results := make([]*Resource, 100)
+
+    wg.Add(len(results))
+    for i := range results {
+        go func(i int) {
+            defer wg.Done()
+            results[i] = lazy.Get()
+        }(i)
+    }
+    wg.Wait()
+
+    samePointer := true
+    for _, r := range results {
+        if r != results[0] {
+            samePointer = false
+        }
+    }
+    fmt.Println("Init ran:", atomic.LoadInt32(&lazy.initCount), "time(s)")
+    fmt.Println("All callers got the same resource:", samePointer)
+    if atomic.LoadInt32(&lazy.initCount) != 1 || !samePointer {
+        log.Fatalf("init ran %d times, all callers got the same resource: %v", atomic.LoadInt32(&lazy.initCount), samePointer)
+    }
+}
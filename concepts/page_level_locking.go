@@ -1,82 +1,2052 @@
+// Run with lru.go, which holds the buffer pool's LRU cache:
+// go run page_level_locking.go lru.go
 package main
 
 import (
+    "bytes"
+    "encoding/binary"
+    "errors"
     "fmt"
+    "hash/crc32"
+    "io"
+    "log"
     "math/rand"
+    "os"
+    "path/filepath"
+    "runtime"
+    "slices"
+    "sort"
     "sync"
+    "sync/atomic"
     "time"
 )
 
+// Default geometry used by main; each PagedFile carries its own.
 const (
-    PageSize   = 1024 // bytes
-    NumPages   = 10
-    TotalSize  = PageSize * NumPages
-    NumWriters = 5
+    PageSize      = 1024 // bytes
+    NumPages      = 10
+    NumWriters    = 5
+    NumIterations = 5 // writes per writer
+)
+
+var (
+    ErrPageOutOfRange = errors.New("page index out of range")
+    ErrDataTooLarge   = errors.New("data larger than page size")
+    ErrDeadlock       = errors.New("deadlock detected")
+    ErrAbort          = errors.New("transaction must abort")
+    ErrFileFull       = errors.New("no free pages")
+    ErrPageNotInUse   = errors.New("page is not allocated")
+    ErrNoFrames       = errors.New("buffer pool has no frames")
 )
 
 type Page struct {
-    data []byte
-    lock sync.Mutex
+    data     []byte
+    dirty    bool     // modified since the last Flush, guarded by lock
+    checksum uint32   // CRC32 of the page contents as of the last Write
+    shared   int      // live snapshots referencing data, which Write must then copy first
+    lock     pageLock // readers share the page, writers get it exclusively
+}
+
+// pageLock is a reader/writer lock; pages use a *sync.RWMutex unless their
+// file was created with writer priority.
+type pageLock interface {
+    Lock()
+    Unlock()
+    RLock()
+    RUnlock()
+}
+
+// WriterPriorityLock is a reader/writer lock that never lets a writer
+// starve: as soon as a writer is waiting, new readers queue behind it, so
+// the writer only waits for the readers already inside to leave.
+type WriterPriorityLock struct {
+    mu             sync.Mutex
+    readersOK      *sync.Cond // signalled when readers may enter
+    writerOK       *sync.Cond // signalled when a writer may enter
+    activeReaders  int
+    waitingWriters int
+    writing        bool
+}
+
+func NewWriterPriorityLock() *WriterPriorityLock {
+    l := &WriterPriorityLock{}
+    l.readersOK = sync.NewCond(&l.mu)
+    l.writerOK = sync.NewCond(&l.mu)
+    return l
+}
+
+func (l *WriterPriorityLock) RLock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    for l.writing || l.waitingWriters > 0 {
+        l.readersOK.Wait()
+    }
+    l.activeReaders++
+}
+
+func (l *WriterPriorityLock) RUnlock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.activeReaders--
+    if l.activeReaders == 0 {
+        l.writerOK.Signal()
+    }
+}
+
+func (l *WriterPriorityLock) Lock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.waitingWriters++
+    for l.writing || l.activeReaders > 0 {
+        l.writerOK.Wait()
+    }
+    l.waitingWriters--
+    l.writing = true
+}
+
+// Unlock hands the page to the next waiting writer if there is one, and
+// only otherwise lets the queued readers in.
+func (l *WriterPriorityLock) Unlock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.writing = false
+    if l.waitingWriters > 0 {
+        l.writerOK.Signal()
+    } else {
+        l.readersOK.Broadcast()
+    }
 }
 
 type PagedFile struct {
-    pages []*Page
+    pages    []*Page
+    pageSize int
+    file     *os.File // when set, page contents live on disk instead of in Page.data
+
+    allocated []bool // which pages Allocate has handed out, guarded by allocMu
+    allocMu   sync.Mutex
+
+    // Activity counters, updated atomically so they never touch the page locks
+    reads        int64
+    writes       int64
+    bytesWritten int64
+
+    // Double-buffered change log for SwapAndFlush; nil until BufferChanges
+    pending atomic.Pointer[changeBuffer]
+    spare   *changeBuffer // the buffer not taking writes, guarded by swapMu
+    swapMu  sync.Mutex    // one SwapAndFlush at a time
+}
+
+// changeBuffer collects writes between two SwapAndFlush calls.
+type changeBuffer struct {
+    mu      sync.Mutex
+    records []changeRecord
+    sealed  bool // set once swapped out; writers that still hold it must retry
+}
+
+type changeRecord struct {
+    pageIndex int
+    data      []byte
+}
+
+// PagedFileStats is a snapshot of a PagedFile's activity counters.
+type PagedFileStats struct {
+    Reads        int64
+    Writes       int64
+    BytesWritten int64
 }
 
-func NewPagedFile() *PagedFile {
-    pages := make([]*Page, NumPages)
-    for i := 0; i < NumPages; i++ {
+func NewPagedFile(pageSize, numPages int) *PagedFile {
+    pages := make([]*Page, numPages)
+    for i := 0; i < numPages; i++ {
+        data := make([]byte, pageSize)
         pages[i] = &Page{
-            data: make([]byte, PageSize),
+            data:     data,
+            checksum: crc32.ChecksumIEEE(data),
+            lock:     &sync.RWMutex{},
+        }
+    }
+    return &PagedFile{pages: pages, pageSize: pageSize, allocated: make([]bool, numPages)}
+}
+
+// NewPagedFileWithWriterPriority is NewPagedFile with a WriterPriorityLock
+// on every page, so a steady stream of readers can't hold off a writer.
+func NewPagedFileWithWriterPriority(pageSize, numPages int) *PagedFile {
+    pf := NewPagedFile(pageSize, numPages)
+    for _, page := range pf.pages {
+        page.lock = NewWriterPriorityLock()
+    }
+    return pf
+}
+
+// NewFileBackedPagedFile opens (or creates) the file at path and serves pages
+// from it, reading and writing pageSize bytes at offset pageIndex*pageSize.
+// A new or short file is zero-filled to pageSize*numPages bytes.
+func NewFileBackedPagedFile(path string, pageSize, numPages int) (*PagedFile, error) {
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+    if totalSize := int64(pageSize) * int64(numPages); info.Size() < totalSize {
+        // Extending with Truncate fills the new space with zeros
+        if err := file.Truncate(totalSize); err != nil {
+            file.Close()
+            return nil, err
+        }
+    }
+
+    // Pages keep no data in memory; their locks guard their region of the file
+    pages := make([]*Page, numPages)
+    for i := 0; i < numPages; i++ {
+        pages[i] = &Page{lock: &sync.RWMutex{}}
+    }
+    pf := &PagedFile{pages: pages, pageSize: pageSize, file: file, allocated: make([]bool, numPages)}
+
+    // Checksum whatever is already on disk
+    for i, page := range pages {
+        data, err := pf.readLocked(i)
+        if err != nil {
+            file.Close()
+            return nil, err
+        }
+        page.checksum = crc32.ChecksumIEEE(data)
+    }
+    return pf, nil
+}
+
+func (pf *PagedFile) PageSize() int { return pf.pageSize }
+func (pf *PagedFile) NumPages() int { return len(pf.pages) }
+
+// Stats returns the number of successful reads and page writes so far and
+// the bytes those writes stored. Each counter is read separately, so a
+// snapshot taken while others are working may be slightly inconsistent.
+func (pf *PagedFile) Stats() PagedFileStats {
+    return PagedFileStats{
+        Reads:        atomic.LoadInt64(&pf.reads),
+        Writes:       atomic.LoadInt64(&pf.writes),
+        BytesWritten: atomic.LoadInt64(&pf.bytesWritten),
+    }
+}
+
+// Allocate marks the lowest-numbered free page as in use and returns its
+// index, or ErrFileFull if every page is taken.
+func (pf *PagedFile) Allocate() (int, error) {
+    pf.allocMu.Lock()
+    defer pf.allocMu.Unlock()
+
+    for i, used := range pf.allocated {
+        if !used {
+            pf.allocated[i] = true
+            return i, nil
         }
     }
-    return &PagedFile{pages: pages}
+    return 0, ErrFileFull
+}
+
+// Free returns an allocated page to the pool for a later Allocate to reuse.
+func (pf *PagedFile) Free(pageIndex int) error {
+    if pageIndex < 0 || pageIndex >= len(pf.pages) {
+        return fmt.Errorf("free page %d: %w", pageIndex, ErrPageOutOfRange)
+    }
+
+    pf.allocMu.Lock()
+    defer pf.allocMu.Unlock()
+
+    if !pf.allocated[pageIndex] {
+        return fmt.Errorf("free page %d: %w", pageIndex, ErrPageNotInUse)
+    }
+    pf.allocated[pageIndex] = false
+    return nil
+}
+
+// Close releases the backing file, if any.
+func (pf *PagedFile) Close() error {
+    if pf.file == nil {
+        return nil
+    }
+    return pf.file.Close()
 }
 
-func (pf *PagedFile) Write(pageIndex int, data []byte) {
+func (pf *PagedFile) Write(pageIndex int, data []byte) error {
+    if pageIndex < 0 || pageIndex >= len(pf.pages) {
+        return fmt.Errorf("write page %d: %w", pageIndex, ErrPageOutOfRange)
+    }
+    if len(data) > pf.pageSize {
+        return fmt.Errorf("write page %d with %d bytes: %w", pageIndex, len(data), ErrDataTooLarge)
+    }
+
     page := pf.pages[pageIndex]
     page.lock.Lock()
     defer page.lock.Unlock()
 
-    copy(page.data, data)
+    return pf.writeLocked(pageIndex, data)
 }
 
-func (pf *PagedFile) Read(pageIndex int) []byte {
+// writeLocked stores data in a page; the caller must hold the page lock for writing.
+func (pf *PagedFile) writeLocked(pageIndex int, data []byte) error {
     page := pf.pages[pageIndex]
-    page.lock.Lock()
-    defer page.lock.Unlock()
+    if pf.file != nil {
+        if _, err := pf.file.WriteAt(data, int64(pageIndex)*int64(pf.pageSize)); err != nil {
+            return fmt.Errorf("write page %d: %w", pageIndex, err)
+        }
+    } else {
+        // Copy on write: leave the buffer a snapshot references untouched
+        if page.shared > 0 {
+            page.data = append([]byte(nil), page.data...)
+            page.shared = 0
+        }
+        copy(page.data, data)
+        page.dirty = true
+    }
+
+    // Recompute over the whole page so the checksum never goes stale
+    contents, err := pf.readLocked(pageIndex)
+    if err != nil {
+        return err
+    }
+    page.checksum = crc32.ChecksumIEEE(contents)
+    atomic.AddInt64(&pf.writes, 1)
+    atomic.AddInt64(&pf.bytesWritten, int64(len(data)))
+    pf.recordChange(pageIndex, data)
+    return nil
+}
+
+// BufferChanges starts recording every successful write for SwapAndFlush.
+func (pf *PagedFile) BufferChanges() {
+    pf.swapMu.Lock()
+    defer pf.swapMu.Unlock()
+    if pf.pending.Load() == nil {
+        pf.spare = &changeBuffer{sealed: true}
+        pf.pending.Store(&changeBuffer{})
+    }
+}
+
+// recordChange appends a write to the active change buffer, if changes are
+// being buffered. A writer can load the buffer just before SwapAndFlush
+// swaps it out; it then finds the buffer sealed and moves on to the new one.
+func (pf *PagedFile) recordChange(pageIndex int, data []byte) {
+    record := changeRecord{pageIndex: pageIndex, data: append([]byte(nil), data...)}
+    for {
+        buf := pf.pending.Load()
+        if buf == nil {
+            return
+        }
+        buf.mu.Lock()
+        if !buf.sealed {
+            buf.records = append(buf.records, record)
+            buf.mu.Unlock()
+            return
+        }
+        buf.mu.Unlock()
+    }
+}
+
+// SwapAndFlush makes the spare buffer active with one atomic pointer swap,
+// then writes out every change in the buffer it swapped out, each as a
+// 4-byte page index, a 4-byte length and the data written. Unlike Flush, it
+// holds no page lock while writing to w, so writers never wait on the I/O;
+// they only contend briefly on the active buffer's mutex. Returns the
+// number of changes flushed.
+func (pf *PagedFile) SwapAndFlush(w io.Writer) (int, error) {
+    pf.swapMu.Lock()
+    defer pf.swapMu.Unlock()
+    if pf.spare == nil {
+        return 0, nil // BufferChanges was never called
+    }
+
+    // Unsealed under its lock: a writer still holding the buffer from its
+    // last turn as the active one may be checking sealed right now
+    pf.spare.mu.Lock()
+    pf.spare.sealed = false
+    pf.spare.mu.Unlock()
+    old := pf.pending.Swap(pf.spare)
+
+    // Once sealed under its lock, no writer can add to the old buffer
+    old.mu.Lock()
+    old.sealed = true
+    records := old.records
+    old.records = nil
+    old.mu.Unlock()
+    pf.spare = old
+
+    var buf []byte
+    for _, r := range records {
+        buf = binary.BigEndian.AppendUint32(buf, uint32(r.pageIndex))
+        buf = binary.BigEndian.AppendUint32(buf, uint32(len(r.data)))
+        buf = append(buf, r.data...)
+    }
+    if _, err := w.Write(buf); err != nil {
+        return 0, fmt.Errorf("flush %d buffered changes: %w", len(records), err)
+    }
+    return len(records), nil
+}
+
+// WriteMulti applies several page writes atomically with respect to other
+// writers. Pages are always locked in ascending index order and unlocked in
+// reverse, so two concurrent multi-page writers can never deadlock.
+func (pf *PagedFile) WriteMulti(updates map[int][]byte) error {
+    indices := make([]int, 0, len(updates))
+    for pageIndex, data := range updates {
+        if pageIndex < 0 || pageIndex >= len(pf.pages) {
+            return fmt.Errorf("write page %d: %w", pageIndex, ErrPageOutOfRange)
+        }
+        if len(data) > pf.pageSize {
+            return fmt.Errorf("write page %d with %d bytes: %w", pageIndex, len(data), ErrDataTooLarge)
+        }
+        indices = append(indices, pageIndex)
+    }
+    sort.Ints(indices)
+
+    for _, pageIndex := range indices {
+        pf.pages[pageIndex].lock.Lock()
+    }
+    defer func() {
+        for i := len(indices) - 1; i >= 0; i-- {
+            pf.pages[indices[i]].lock.Unlock()
+        }
+    }()
+
+    for _, pageIndex := range indices {
+        if err := pf.writeLocked(pageIndex, updates[pageIndex]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (pf *PagedFile) Read(pageIndex int) ([]byte, error) {
+    if pageIndex < 0 || pageIndex >= len(pf.pages) {
+        return nil, fmt.Errorf("read page %d: %w", pageIndex, ErrPageOutOfRange)
+    }
+
+    page := pf.pages[pageIndex]
+    page.lock.RLock()
+    defer page.lock.RUnlock()
+
+    data, err := pf.readLocked(pageIndex)
+    if err == nil {
+        atomic.AddInt64(&pf.reads, 1)
+    }
+    return data, err
+}
 
+// readLocked returns a copy of the page contents; the caller must hold the page lock.
+func (pf *PagedFile) readLocked(pageIndex int) ([]byte, error) {
+    if pf.file != nil {
+        dataCopy := make([]byte, pf.pageSize)
+        if _, err := pf.file.ReadAt(dataCopy, int64(pageIndex)*int64(pf.pageSize)); err != nil {
+            return nil, fmt.Errorf("read page %d: %w", pageIndex, err)
+        }
+        return dataCopy, nil
+    }
+
+    page := pf.pages[pageIndex]
     dataCopy := make([]byte, len(page.data))
     copy(dataCopy, page.data)
-    return dataCopy
+    return dataCopy, nil
 }
 
-func writer(id int, pf *PagedFile, wg *sync.WaitGroup) {
-    defer wg.Done()
-    rand.Seed(time.Now().UnixNano())
+// Verify recomputes the checksum of a page and reports whether it still
+// matches the one stored by the last Write.
+func (pf *PagedFile) Verify(pageIndex int) (bool, error) {
+    if pageIndex < 0 || pageIndex >= len(pf.pages) {
+        return false, fmt.Errorf("verify page %d: %w", pageIndex, ErrPageOutOfRange)
+    }
 
-    for i := 0; i < 5; i++ {
-        pageIndex := rand.Intn(NumPages)
-        data := []byte(fmt.Sprintf("Writer %d writing to page %d", id, pageIndex))
-        pf.Write(pageIndex, data)
-        fmt.Printf("Writer %d wrote to page %d\n", id, pageIndex)
-        time.Sleep(100 * time.Millisecond)
+    page := pf.pages[pageIndex]
+    page.lock.RLock()
+    defer page.lock.RUnlock()
+
+    data, err := pf.readLocked(pageIndex)
+    if err != nil {
+        return false, err
     }
+    return crc32.ChecksumIEEE(data) == page.checksum, nil
 }
 
-func main() {
-    pf := NewPagedFile()
-    var wg sync.WaitGroup
+// VerifyAll returns the indices of pages whose contents no longer match their checksum.
+func (pf *PagedFile) VerifyAll() []int {
+    var corrupted []int
+    for i := range pf.pages {
+        if ok, err := pf.Verify(i); err != nil || !ok {
+            corrupted = append(corrupted, i)
+        }
+    }
+    return corrupted
+}
+
+// Flush writes every dirty page to w in page-index order, each as a 4-byte
+// big-endian page index followed by the page's data, and marks them
+// clean. Returns the number of pages flushed.
+func (pf *PagedFile) Flush(w io.Writer) (int, error) {
+    flushed := 0
+    for i, page := range pf.pages {
+        page.lock.Lock()
+        if !page.dirty {
+            page.lock.Unlock()
+            continue
+        }
+        err := binary.Write(w, binary.BigEndian, uint32(i))
+        if err == nil {
+            _, err = w.Write(page.data)
+        }
+        if err == nil {
+            page.dirty = false
+        }
+        page.lock.Unlock()
 
-    wg.Add(NumWriters)
-    for i := 0; i < NumWriters; i++ {
-        go writer(i, pf, &wg)
+        if err != nil {
+            return flushed, fmt.Errorf("flush page %d: %w", i, err)
+        }
+        flushed++
     }
-    wg.Wait()
+    return flushed, nil
+}
 
-    // Reading all pages
+// PageSnapshot is a point-in-time view of every page in a PagedFile.
+type PageSnapshot struct {
+    pf       *PagedFile
+    pages    [][]byte
+    released bool
+}
+
+// Snapshot captures the current contents of every page. In-memory pages are
+// captured by reference, and a later Write copies a page before changing it,
+// so taking a snapshot costs nothing per byte. File-backed pages have no
+// in-memory buffer to share, so they are copied up front.
+func (pf *PagedFile) Snapshot() (*PageSnapshot, error) {
+    // Lock every page, in the same order as WriteMulti, for a consistent view
+    for _, page := range pf.pages {
+        page.lock.Lock()
+    }
+    defer func() {
+        for i := len(pf.pages) - 1; i >= 0; i-- {
+            pf.pages[i].lock.Unlock()
+        }
+    }()
+
+    snap := &PageSnapshot{pf: pf, pages: make([][]byte, len(pf.pages))}
     for i, page := range pf.pages {
-        data := page.data
-        fmt.Printf("Page %d contains: %s\n", i, string(data))
+        if pf.file != nil {
+            data, err := pf.readLocked(i)
+            if err != nil {
+                return nil, err
+            }
+            snap.pages[i] = data
+            continue
+        }
+        snap.pages[i] = page.data
+        page.shared++
+    }
+    return snap, nil
+}
+
+// Read returns a copy of a page as it was when the snapshot was taken.
+func (snap *PageSnapshot) Read(pageIndex int) ([]byte, error) {
+    if pageIndex < 0 || pageIndex >= len(snap.pages) {
+        return nil, fmt.Errorf("read snapshot page %d: %w", pageIndex, ErrPageOutOfRange)
+    }
+    return append([]byte(nil), snap.pages[pageIndex]...), nil
+}
+
+// Release drops the snapshot's references, so writes to pages it still
+// shares no longer need to copy them.
+func (snap *PageSnapshot) Release() {
+    if snap.released {
+        return
+    }
+    snap.released = true
+    if snap.pf.file != nil {
+        return
+    }
+    for i, page := range snap.pf.pages {
+        page.lock.Lock()
+        // Only pages not written since the snapshot still share its buffer
+        if len(page.data) > 0 && &page.data[0] == &snap.pages[i][0] {
+            page.shared--
+        }
+        page.lock.Unlock()
+    }
+    snap.pages = nil
+}
+
+// BufferPool caches up to capacity pages of a file-backed PagedFile in
+// memory, evicting the least recently used page (writing it back first if
+// dirty) when a miss would exceed capacity.
+type BufferPool struct {
+    file     *PagedFile
+    capacity int
+    frames   *LRUCache[int, *Page] // resident pages by index
+    hits     int
+    misses   int
+    lock     sync.Mutex
+
+    // Readahead; prefetch is nil unless created with NewBufferPoolWithPrefetch
+    prefetch   chan int       // pages waiting for the prefetcher
+    prefetched int            // pages the prefetcher loaded, guarded by lock
+    pending    sync.WaitGroup // one per queued page, done once it is loaded
+    stopped    sync.WaitGroup // the prefetcher goroutine
+}
+
+func NewBufferPool(file *PagedFile, capacity int) *BufferPool {
+    return &BufferPool{
+        file:     file,
+        capacity: capacity,
+        frames:   NewLRUCache[int, *Page](capacity),
+    }
+}
+
+// NewBufferPoolWithPrefetch starts a background goroutine that loads pages
+// queued by Prefetch, with room for queueSize pages waiting at once. Call
+// StopPrefetch to stop it.
+func NewBufferPoolWithPrefetch(file *PagedFile, capacity, queueSize int) *BufferPool {
+    bp := NewBufferPool(file, capacity)
+    bp.prefetch = make(chan int, queueSize)
+    bp.stopped.Add(1)
+    go bp.prefetcher()
+    return bp
+}
+
+// Prefetch asks for count pages from startPage to be loaded in the
+// background, so a sequential scan finds them already resident. Readahead
+// is only a hint: pages that don't fit in the queue are dropped rather than
+// making the caller wait, and a range larger than the pool evicts its own
+// first pages. Does nothing without a prefetcher.
+func (bp *BufferPool) Prefetch(startPage, count int) {
+    if bp.prefetch == nil {
+        return
+    }
+    end := min(startPage+count, bp.file.NumPages())
+    for pageIndex := max(startPage, 0); pageIndex < end; pageIndex++ {
+        bp.pending.Add(1)
+        select {
+        case bp.prefetch <- pageIndex:
+        default:
+            bp.pending.Done()
+            return
+        }
+    }
+}
+
+// WaitPrefetch blocks until every page queued so far has been loaded.
+func (bp *BufferPool) WaitPrefetch() {
+    bp.pending.Wait()
+}
+
+// StopPrefetch stops the prefetcher once its queue is drained. Prefetch must
+// not be called afterwards.
+func (bp *BufferPool) StopPrefetch() {
+    if bp.prefetch != nil {
+        close(bp.prefetch)
+        bp.stopped.Wait()
+    }
+}
+
+// prefetcher loads queued pages that aren't already resident. They count as
+// neither hits nor misses; a failed load is dropped, since the Get that
+// eventually wants the page will report the error.
+func (bp *BufferPool) prefetcher() {
+    defer bp.stopped.Done()
+    for pageIndex := range bp.prefetch {
+        bp.lock.Lock()
+        if _, ok := bp.frames.Get(pageIndex); !ok {
+            if _, err := bp.load(pageIndex); err == nil {
+                bp.prefetched++
+            }
+        }
+        bp.lock.Unlock()
+        bp.pending.Done()
+    }
+}
+
+// Get returns the in-memory frame for a page, loading it from disk on a miss.
+// The frame isn't pinned, so another miss may evict it once Get returns;
+// changes must go through Write.
+func (bp *BufferPool) Get(pageIndex int) (*Page, error) {
+    bp.lock.Lock()
+    defer bp.lock.Unlock()
+    return bp.getLocked(pageIndex)
+}
+
+// getLocked is Get for a caller that holds bp.lock.
+func (bp *BufferPool) getLocked(pageIndex int) (*Page, error) {
+    if page, ok := bp.frames.Get(pageIndex); ok {
+        bp.hits++
+        return page, nil
+    }
+    bp.misses++
+    return bp.load(pageIndex)
+}
+
+// load reads a page from disk into a new frame; the caller must hold bp.lock.
+func (bp *BufferPool) load(pageIndex int) (*Page, error) {
+    data, err := bp.file.Read(pageIndex)
+    if err != nil {
+        return nil, err
+    }
+    // Evict before inserting, so a dirty victim is written back rather than
+    // silently dropped by the cache
+    if bp.frames.Len() >= bp.capacity {
+        if err := bp.evict(); err != nil {
+            return nil, err
+        }
+    }
+
+    page := &Page{data: data, checksum: crc32.ChecksumIEEE(data), lock: &sync.RWMutex{}}
+    bp.frames.Put(pageIndex, page)
+    return page, nil
+}
+
+// Write updates a page through the pool; the change reaches disk on eviction
+// or the next Flush.
+// The lookup and the copy both happen under bp.lock, so no concurrent miss
+// can evict the frame in between and drop the write with it.
+func (bp *BufferPool) Write(pageIndex int, data []byte) error {
+    if len(data) > bp.file.pageSize {
+        return fmt.Errorf("write page %d with %d bytes: %w", pageIndex, len(data), ErrDataTooLarge)
+    }
+    bp.lock.Lock()
+    defer bp.lock.Unlock()
+    page, err := bp.getLocked(pageIndex)
+    if err != nil {
+        return err
+    }
+
+    page.lock.Lock()
+    defer page.lock.Unlock()
+    copy(page.data, data)
+    page.dirty = true
+    return nil
+}
+
+// Stats reports cache hits and misses so far.
+func (bp *BufferPool) Stats() (hits, misses int) {
+    bp.lock.Lock()
+    defer bp.lock.Unlock()
+    return bp.hits, bp.misses
+}
+
+// Flush writes every dirty resident page back to the file, leaving the pages
+// resident, and returns how many it wrote.
+func (bp *BufferPool) Flush() (int, error) {
+    bp.lock.Lock()
+    defer bp.lock.Unlock()
+
+    flushed := 0
+    for _, pageIndex := range bp.frames.Keys() {
+        page, _ := bp.frames.Peek(pageIndex)
+        page.lock.Lock()
+        if page.dirty {
+            if err := bp.file.Write(pageIndex, page.data); err != nil {
+                page.lock.Unlock()
+                return flushed, fmt.Errorf("flush page %d: %w", pageIndex, err)
+            }
+            page.dirty = false
+            flushed++
+        }
+        page.lock.Unlock()
+    }
+    return flushed, nil
+}
+
+// evict drops the least recently used frame; the caller must hold bp.lock.
+// A pool with no frames has nothing to evict, so every miss fails.
+func (bp *BufferPool) evict() error {
+    victim, page, ok := bp.frames.Oldest()
+    if !ok {
+        return ErrNoFrames
+    }
+
+    page.lock.Lock()
+    defer page.lock.Unlock()
+    if page.dirty {
+        if err := bp.file.Write(victim, page.data); err != nil {
+            return fmt.Errorf("evict page %d: %w", victim, err)
+        }
+        page.dirty = false
+    }
+
+    bp.frames.Remove(victim)
+    return nil
+}
+
+func lruExample() {
+    cache := NewLRUCache[string, int](2)
+    cache.Put("a", 1)
+    cache.Put("b", 2)
+    cache.Get("a")    // a is now the most recently used
+    cache.Put("c", 3) // evicts b
+    _, ok := cache.Get("b")
+    fmt.Println("LRU keeps", cache.Keys(), "- b still cached:", ok)
+    if ok {
+        log.Fatal("LRU kept b after evicting the least recently used key")
+    }
+
+    cache.Put("a", 10) // updating a also makes it most recently used
+    cache.Put("d", 4)  // so c is evicted, not a
+    keys := cache.Keys()
+    value, _ := cache.Get("a")
+    fmt.Println("After updating a:", keys, "a =", value, "len =", cache.Len())
+    if _, ok := cache.Get("c"); ok || value != 10 || cache.Len() != 2 {
+        log.Fatalf("after updating a: c cached: %v, a = %d, len = %d", ok, value, cache.Len())
+    }
+}
+
+func bufferPoolExample() {
+    dir, err := os.MkdirTemp("", "buffer_pool")
+    if err != nil {
+        fmt.Println("Error creating temp dir:", err)
+        return
+    }
+    defer os.RemoveAll(dir)
+
+    pf, err := NewFileBackedPagedFile(filepath.Join(dir, "pages.db"), PageSize, NumPages)
+    if err != nil {
+        fmt.Println("Error opening paged file:", err)
+        return
+    }
+    defer pf.Close()
+
+    pool := NewBufferPool(pf, 2)
+    pool.Write(1, []byte("written through the pool"))
+    pool.Get(0)
+    pool.Get(1) // page 0 is now the least recently used
+    pool.Get(2) // evicts page 0
+    pool.Get(3) // evicts page 1, writing it back since it is dirty
+
+    hits, misses := pool.Stats()
+    fmt.Println("Buffer pool hits:", hits, "misses:", misses, "resident:", pool.frames.Keys())
+    data, _ := pf.Read(1)
+    fmt.Printf("Page 1 on disk after eviction: %s\n", bytes.TrimRight(data, "\x00"))
+    if !bytes.HasPrefix(data, []byte("written through the pool")) {
+        log.Fatal("evicting a dirty page did not write it back")
+    }
+
+    // Flush writes back dirty pages that are still resident
+    pool.Write(3, []byte("flushed without eviction"))
+    flushed, err := pool.Flush()
+    data, _ = pf.Read(3)
+    fmt.Printf("Flush wrote %d page(s) (err: %v); page 3 on disk: %s\n", flushed, err, bytes.TrimRight(data, "\x00"))
+    if err != nil || flushed != 1 || !bytes.HasPrefix(data, []byte("flushed without eviction")) {
+        log.Fatalf("Flush wrote %d pages (err: %v), want page 3 written back", flushed, err)
+    }
+    if flushed, _ = pool.Flush(); flushed != 0 {
+        log.Fatalf("second Flush wrote %d clean pages", flushed)
+    }
+
+    _, err = NewBufferPool(pf, 0).Get(0)
+    fmt.Println("Get through a pool with no frames:", err)
+    if !errors.Is(err, ErrNoFrames) {
+        log.Fatalf("Get through a pool with no frames returned %v, want %v", err, ErrNoFrames)
+    }
+
+    concurrentPoolWritesExample(pf)
+    prefetchExample(pf)
+}
+
+// concurrentPoolWritesExample has every goroutine keep rewriting its own
+// page through a pool far smaller than the file, while the others' misses
+// keep evicting frames, then checks each page holds its last write.
+func concurrentPoolWritesExample(pf *PagedFile) {
+    const rounds = 20
+    pool := NewBufferPool(pf, 2)
+    var wg sync.WaitGroup
+    for g := 0; g < NumPages; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < rounds; i++ {
+                pool.Write(g, []byte(fmt.Sprintf("page %d write %02d", g, i)))
+                runtime.Gosched()
+            }
+        }(g)
+    }
+    wg.Wait()
+
+    lost := 0
+    for g := 0; g < NumPages; g++ {
+        want := fmt.Sprintf("page %d write %02d", g, rounds-1)
+        page, err := pool.Get(g)
+        if err != nil || !bytes.HasPrefix(page.data, []byte(want)) {
+            lost++
+        }
+    }
+    fmt.Printf("Concurrent writes through a 2-frame pool: %d of %d pages lost their last write\n", lost, NumPages)
+    if lost > 0 {
+        log.Fatalf("buffer pool lost writes to %d pages", lost)
+    }
+}
+
+// prefetchExample scans every page in order through a pool that fits them
+// all, once cold and once after prefetching the whole range.
+func prefetchExample(pf *PagedFile) {
+    for _, readahead := range []bool{false, true} {
+        pool := NewBufferPoolWithPrefetch(pf, NumPages, NumPages)
+        if readahead {
+            pool.Prefetch(0, NumPages)
+            pool.WaitPrefetch()
+        }
+        for i := 0; i < NumPages; i++ {
+            pool.Get(i)
+        }
+        pool.StopPrefetch()
+
+        hits, misses := pool.Stats()
+        fmt.Printf("Sequential scan (prefetch: %v): %d hits, %d misses, %d pages prefetched\n",
+            readahead, hits, misses, pool.prefetched)
+        if readahead && misses != 0 {
+            log.Fatalf("scan after prefetching every page missed %d times", misses)
+        }
+    }
+}
+
+// TxInfo describes a transaction caught in a deadlock, for a VictimPolicy.
+type TxInfo struct {
+    ID        int
+    Age       int // order in which the lock manager first saw the transaction; larger is younger
+    LocksHeld int
+    Work      int // locks acquired so far, a rough measure of work that aborting would waste
+}
+
+// VictimPolicy picks which transaction in a deadlock cycle to abort. It
+// returns an index into candidates, whose first entry is the requester
+// whose Acquire closed the cycle.
+type VictimPolicy interface {
+    Choose(candidates []TxInfo) int
+}
+
+// RequesterPolicy aborts whoever closed the cycle, which needs no
+// bookkeeping but may abort a transaction that has done a lot of work.
+type RequesterPolicy struct{}
+
+func (RequesterPolicy) Choose(candidates []TxInfo) int { return 0 }
+
+// YoungestPolicy aborts the most recently started transaction, so older
+// ones, which have likely done more, keep going.
+type YoungestPolicy struct{}
+
+func (YoungestPolicy) Choose(candidates []TxInfo) int {
+    return chooseMax(candidates, func(tx TxInfo) int { return tx.Age })
+}
+
+// FewestLocksPolicy aborts the transaction holding the fewest locks.
+type FewestLocksPolicy struct{}
+
+func (FewestLocksPolicy) Choose(candidates []TxInfo) int {
+    return chooseMax(candidates, func(tx TxInfo) int { return -tx.LocksHeld })
+}
+
+// LeastWorkPolicy aborts the transaction that has acquired the fewest locks overall.
+type LeastWorkPolicy struct{}
+
+func (LeastWorkPolicy) Choose(candidates []TxInfo) int {
+    return chooseMax(candidates, func(tx TxInfo) int { return -tx.Work })
+}
+
+// chooseMax returns the index of the candidate with the largest score,
+// preferring the earliest on ties.
+func chooseMax(candidates []TxInfo, score func(TxInfo) int) int {
+    best := 0
+    for i := range candidates {
+        if score(candidates[i]) > score(candidates[best]) {
+            best = i
+        }
+    }
+    return best
+}
+
+// LockManager hands out exclusive page locks to transactions and keeps a
+// wait-for graph of who is blocked on whom. When a request would close a
+// cycle in that graph, the policy picks a transaction in the cycle to fail
+// with ErrDeadlock instead of everyone waiting forever.
+type LockManager struct {
+    holders  map[int]int           // pageIndex -> txID holding it
+    holderTS map[int]int64         // pageIndex -> start timestamp of its holder, for wait-die and wound-wait
+    waiting  map[int]int           // txID -> pageIndex it is blocked on
+    wounds   map[int]chan struct{} // txID -> closed once an older transaction wounds it
+    victims  map[int]bool          // waiting txIDs chosen to break a deadlock
+    ages     map[int]int           // txID -> order first seen, for TxInfo.Age
+    work     map[int]int           // txID -> locks acquired, for TxInfo.Work
+    policy   VictimPolicy
+    mu       sync.Mutex
+    cond     *sync.Cond
+}
+
+func NewLockManager() *LockManager {
+    return NewLockManagerWithPolicy(RequesterPolicy{})
+}
+
+func NewLockManagerWithPolicy(policy VictimPolicy) *LockManager {
+    lm := &LockManager{
+        holders:  make(map[int]int),
+        holderTS: make(map[int]int64),
+        waiting:  make(map[int]int),
+        wounds:   make(map[int]chan struct{}),
+        victims:  make(map[int]bool),
+        ages:     make(map[int]int),
+        work:     make(map[int]int),
+        policy:   policy,
+    }
+    lm.cond = sync.NewCond(&lm.mu)
+    return lm
+}
+
+// Acquire blocks until txID holds pageIndex, or returns ErrDeadlock if the
+// policy picks txID to break a deadlock, whether the cycle was closed by
+// this request or by a later one. The caller should then release its locks
+// so the other transactions can make progress.
+func (lm *LockManager) Acquire(txID int, pageIndex int) error {
+    lm.mu.Lock()
+    defer lm.mu.Unlock()
+
+    if _, seen := lm.ages[txID]; !seen {
+        lm.ages[txID] = len(lm.ages)
+    }
+    for {
+        if lm.victims[txID] {
+            delete(lm.victims, txID)
+            delete(lm.waiting, txID)
+            return fmt.Errorf("tx %d chosen as victim while waiting for page %d: %w", txID, pageIndex, ErrDeadlock)
+        }
+        holder, held := lm.holders[pageIndex]
+        if !held || holder == txID {
+            lm.holders[pageIndex] = txID
+            lm.work[txID]++
+            delete(lm.waiting, txID)
+            return nil
+        }
+        if chain := lm.waitChain(holder, txID); chain != nil {
+            cycle := append([]int{txID}, chain...)
+            victim := cycle[lm.policy.Choose(lm.txInfo(cycle))]
+            if victim == txID {
+                delete(lm.waiting, txID)
+                return fmt.Errorf("tx %d waiting for page %d held by tx %d: %w", txID, pageIndex, holder, ErrDeadlock)
+            }
+            // The victim is blocked in Acquire; wake it to fail, then wait
+            // for it to release what it holds
+            lm.victims[victim] = true
+            lm.cond.Broadcast()
+        }
+        lm.waiting[txID] = pageIndex
+        lm.cond.Wait()
+    }
+}
+
+// txInfo describes each transaction in txIDs; the caller must hold lm.mu.
+func (lm *LockManager) txInfo(txIDs []int) []TxInfo {
+    infos := make([]TxInfo, len(txIDs))
+    for i, txID := range txIDs {
+        infos[i] = TxInfo{ID: txID, Age: lm.ages[txID], Work: lm.work[txID]}
+        for _, holder := range lm.holders {
+            if holder == txID {
+                infos[i].LocksHeld++
+            }
+        }
+    }
+    return infos
+}
+
+// Release gives up txID's lock on pageIndex.
+func (lm *LockManager) Release(txID int, pageIndex int) {
+    lm.mu.Lock()
+    defer lm.mu.Unlock()
+
+    if lm.holders[pageIndex] == txID {
+        delete(lm.holders, pageIndex)
+        delete(lm.holderTS, pageIndex)
+        lm.cond.Broadcast()
+    }
+}
+
+// AcquireWaitDie prevents deadlock instead of detecting it, using each
+// transaction's start timestamp ts (smaller is older). An older requester
+// waits for a younger holder, but a younger requester dies: it gets
+// ErrAbort and should abort and retry later with its original timestamp.
+// Since waits only ever go from older to younger, no cycle can form. Every
+// transaction sharing the pages should lock through this method, as pages
+// locked with Acquire carry no timestamp and count as the oldest holder.
+func (lm *LockManager) AcquireWaitDie(txID int, ts int64, pageIndex int) error {
+    lm.mu.Lock()
+    defer lm.mu.Unlock()
+
+    for {
+        holder, held := lm.holders[pageIndex]
+        if !held || holder == txID {
+            lm.holders[pageIndex] = txID
+            lm.holderTS[pageIndex] = ts
+            delete(lm.waiting, txID)
+            return nil
+        }
+        if ts >= lm.holderTS[pageIndex] {
+            delete(lm.waiting, txID)
+            return fmt.Errorf("tx %d dies waiting for page %d held by older tx %d: %w", txID, pageIndex, holder, ErrAbort)
+        }
+        lm.waiting[txID] = pageIndex
+        lm.cond.Wait()
+    }
+}
+
+// waitChain follows the wait-for graph from from and, if it leads back to
+// target, returns the transactions along the way (from first). It returns
+// nil if there is no such cycle, or if a victim already chosen for it has
+// yet to wake up and fail; the caller must hold lm.mu.
+func (lm *LockManager) waitChain(from, target int) []int {
+    var chain []int
+    visited := make(map[int]bool)
+    for tx := from; !visited[tx]; {
+        if lm.victims[tx] {
+            return nil
+        }
+        visited[tx] = true
+        chain = append(chain, tx)
+        pageIndex, blocked := lm.waiting[tx]
+        if !blocked {
+            return nil
+        }
+        tx = lm.holders[pageIndex]
+        if tx == target {
+            return chain
+        }
+    }
+    return nil
+}
+
+var (
+    ErrTxFinished   = errors.New("transaction already committed or aborted")
+    ErrBadSavepoint = errors.New("no such savepoint")
+)
+
+// Transaction implements strict two-phase locking over a PagedFile: it
+// locks each page on first use and holds every lock until Commit or Abort.
+// Each write logs the page's before-image so Abort can undo it.
+type Transaction struct {
+    id      int
+    pf      *PagedFile
+    lm      *LockManager
+    locked  []int       // pages locked so far, in acquisition order
+    undo    []undoEntry // before-images, oldest first
+    done    bool
+    onAbort []func()
+    metrics TxMetrics
+}
+
+// TxMetrics describes what a Transaction has done so far. Committed and
+// Aborted are both false while it is still running.
+type TxMetrics struct {
+    PagesRead     int
+    PagesWritten  int
+    LocksAcquired int
+    Committed     bool
+    Aborted       bool
+}
+
+type undoEntry struct {
+    pageIndex int
+    before    []byte
+}
+
+func NewTransaction(id int, pf *PagedFile, lm *LockManager) *Transaction {
+    return &Transaction{id: id, pf: pf, lm: lm}
+}
+
+// lock acquires pageIndex for this transaction unless it already holds it.
+func (tx *Transaction) lock(pageIndex int) error {
+    if tx.done {
+        return ErrTxFinished
+    }
+    for _, held := range tx.locked {
+        if held == pageIndex {
+            return nil
+        }
+    }
+    if err := tx.lm.Acquire(tx.id, pageIndex); err != nil {
+        // A deadlock victim can't go on, so roll it back right away and
+        // free its locks for the transactions it was blocking
+        if errors.Is(err, ErrDeadlock) {
+            tx.Abort()
+        }
+        return err
+    }
+    tx.metrics.LocksAcquired++
+    tx.locked = append(tx.locked, pageIndex)
+    return nil
+}
+
+func (tx *Transaction) ReadPage(pageIndex int) ([]byte, error) {
+    if err := tx.lock(pageIndex); err != nil {
+        return nil, err
+    }
+    data, err := tx.pf.Read(pageIndex)
+    if err == nil {
+        tx.metrics.PagesRead++
+    }
+    return data, err
+}
+
+func (tx *Transaction) WritePage(pageIndex int, data []byte) error {
+    if err := tx.lock(pageIndex); err != nil {
+        return err
+    }
+    before, err := tx.pf.Read(pageIndex)
+    if err != nil {
+        return err
+    }
+    if err := tx.pf.Write(pageIndex, data); err != nil {
+        return err
+    }
+    tx.undo = append(tx.undo, undoEntry{pageIndex: pageIndex, before: before})
+    tx.metrics.PagesWritten++
+    return nil
+}
+
+func (tx *Transaction) Commit() error {
+    if tx.done {
+        return ErrTxFinished
+    }
+    tx.releaseAll()
+    tx.metrics.Committed = true
+    return nil
+}
+
+// OnAbort registers fn to run when the transaction rolls back, whether the
+// caller aborts it or it is rolled back as a deadlock victim. Hooks run in
+// registration order, after the pages are restored and the locks released.
+func (tx *Transaction) OnAbort(fn func()) {
+    tx.onAbort = append(tx.onAbort, fn)
+}
+
+func (tx *Transaction) Metrics() TxMetrics {
+    return tx.metrics
+}
+
+// Savepoint marks the current point in the transaction's write history for
+// a later RollbackTo.
+func (tx *Transaction) Savepoint() int {
+    return len(tx.undo)
+}
+
+// RollbackTo undoes every write made since savepoint sp, newest first,
+// leaving earlier writes in place. Locks are kept, as strict 2PL requires:
+// the transaction is still running and may write those pages again.
+// Savepoints taken after sp are no longer valid afterwards.
+func (tx *Transaction) RollbackTo(sp int) error {
+    if tx.done {
+        return ErrTxFinished
+    }
+    if sp < 0 || sp > len(tx.undo) {
+        return fmt.Errorf("rollback to savepoint %d: %w", sp, ErrBadSavepoint)
+    }
+    err := tx.undoTo(sp)
+    tx.undo = tx.undo[:sp]
+    return err
+}
+
+// Abort restores every page this transaction wrote, newest write first,
+// then releases its locks.
+func (tx *Transaction) Abort() error {
+    if tx.done {
+        return ErrTxFinished
+    }
+    err := tx.undoTo(0)
+    tx.releaseAll()
+    tx.metrics.Aborted = true
+    for _, fn := range tx.onAbort {
+        fn()
+    }
+    return err
+}
+
+// undoTo writes back the before-images of undo entries sp and later,
+// newest first, and returns the first error.
+func (tx *Transaction) undoTo(sp int) error {
+    var err error
+    for i := len(tx.undo) - 1; i >= sp; i-- {
+        entry := tx.undo[i]
+        if writeErr := tx.pf.Write(entry.pageIndex, entry.before); writeErr != nil && err == nil {
+            err = writeErr
+        }
+    }
+    return err
+}
+
+func (tx *Transaction) releaseAll() {
+    for _, pageIndex := range tx.locked {
+        tx.lm.Release(tx.id, pageIndex)
+    }
+    tx.locked = nil
+    tx.undo = nil
+    tx.done = true
+}
+
+func twoPhaseLockingExample() {
+    pf := NewPagedFile(PageSize, NumPages)
+    lm := NewLockManager()
+    pf.Write(0, []byte("original"))
+
+    // Aborting restores the before-image
+    tx := NewTransaction(1, pf, lm)
+    tx.WritePage(0, []byte("uncommitted"))
+    tx.Abort()
+    data, _ := pf.Read(0)
+    fmt.Printf("After abort, page 0 contains: %s\n", bytes.TrimRight(data, "\x00"))
+    if !bytes.HasPrefix(data, []byte("original")) {
+        log.Fatal("abort did not restore the before-image of page 0")
+    }
+
+    // A second transaction touching the same page waits for the first to finish
+    tx1 := NewTransaction(2, pf, lm)
+    tx1.WritePage(0, []byte("from tx1"))
+
+    done := make(chan []byte)
+    go func() {
+        tx2 := NewTransaction(3, pf, lm)
+        data, _ := tx2.ReadPage(0)
+        tx2.Commit()
+        done <- data
+    }()
+
+    time.Sleep(50 * time.Millisecond)
+    tx1.Commit()
+    data = <-done
+    fmt.Printf("tx2 read page 0 after tx1 committed: %s\n", bytes.TrimRight(data, "\x00"))
+    if !bytes.HasPrefix(data, []byte("from tx1")) {
+        log.Fatal("tx2 read page 0 before tx1 committed")
+    }
+}
+
+func abortHookExample() {
+    pf := NewPagedFile(PageSize, NumPages)
+    lm := NewLockManager()
+
+    // tx1 holds page 0 and waits for page 1; tx2 holds page 1 and asks for
+    // page 0, closing the cycle, so tx2 is rolled back as the requester
+    tx1, tx2 := NewTransaction(1, pf, lm), NewTransaction(2, pf, lm)
+    tx1.WritePage(0, []byte("tx1"))
+    tx2.WritePage(1, []byte("tx2"))
+    hookRan := false
+    tx2.OnAbort(func() {
+        hookRan = true
+        fmt.Println("tx2 abort hook ran")
+    })
+
+    done := make(chan error)
+    go func() { done <- tx1.WritePage(1, []byte("tx1")) }()
+    time.Sleep(50 * time.Millisecond)
+    _, err := tx2.ReadPage(0)
+    fmt.Println("tx2 asking for page 0:", err)
+    tx1Err := <-done
+    fmt.Println("tx1 got page 1 after tx2 rolled back:", tx1Err)
+    if err == nil || tx1Err != nil {
+        log.Fatalf("want only tx2 rolled back, got %v / %v", err, tx1Err)
+    }
+    tx1.Commit()
+
+    fmt.Printf("tx1 metrics: %+v\n", tx1.Metrics())
+    fmt.Printf("tx2 metrics: %+v\n", tx2.Metrics())
+    if !hookRan {
+        log.Fatal("tx2 was rolled back without running its abort hook")
+    }
+    if m := tx2.Metrics(); !m.Aborted || m.Committed {
+        log.Fatalf("tx2 metrics after rollback: %+v", m)
+    }
+    if m := tx1.Metrics(); !m.Committed || m.Aborted {
+        log.Fatalf("tx1 metrics after commit: %+v", m)
+    }
+}
+
+func savepointExample() {
+    pf := NewPagedFile(PageSize, NumPages)
+    lm := NewLockManager()
+
+    // Write page 1, take a savepoint, write page 2, then undo only page 2
+    tx := NewTransaction(1, pf, lm)
+    tx.WritePage(1, []byte("page A"))
+    sp := tx.Savepoint()
+    tx.WritePage(2, []byte("page B"))
+    tx.RollbackTo(sp)
+    tx.Commit()
+
+    a, _ := pf.Read(1)
+    b, _ := pf.Read(2)
+    fmt.Printf("After RollbackTo and Commit: page 1 = %q, page 2 = %q\n", bytes.TrimRight(a, "\x00"), bytes.TrimRight(b, "\x00"))
+    if string(bytes.TrimRight(a, "\x00")) != "page A" || len(bytes.TrimRight(b, "\x00")) != 0 {
+        log.Fatal("RollbackTo did not undo exactly the writes after the savepoint")
+    }
+
+    tx = NewTransaction(2, pf, lm)
+    err := tx.RollbackTo(5)
+    fmt.Println("RollbackTo an unknown savepoint:", err)
+    if err == nil {
+        log.Fatal("RollbackTo accepted an unknown savepoint")
+    }
+    tx.Abort()
+}
+
+func deadlockDetectionExample() {
+    lm := NewLockManager()
+    const pageA, pageB = 0, 1
+
+    // tx1 holds A and wants B; tx2 holds B and wants A
+    lm.Acquire(1, pageA)
+    lm.Acquire(2, pageB)
+
+    done := make(chan error)
+    go func() {
+        done <- lm.Acquire(1, pageB)
+    }()
+
+    // Wait until tx1 is blocked on B before closing the cycle
+    for {
+        lm.mu.Lock()
+        _, blocked := lm.waiting[1]
+        lm.mu.Unlock()
+        if blocked {
+            break
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    err := lm.Acquire(2, pageA)
+    fmt.Println("tx2 acquiring A:", err)
+    if err == nil {
+        log.Fatal("closing the cycle was not detected as a deadlock")
+    }
+
+    // The victim backs off, letting tx1 proceed
+    lm.Release(2, pageB)
+    err = <-done
+    fmt.Println("tx1 acquiring B:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+}
+
+func waitDieExample() {
+    lm := NewLockManager()
+    const older, younger = 1, 2
+    const olderTS, youngerTS = 100, 200
+
+    // Younger requests a page the older transaction holds: it dies at once
+    lm.AcquireWaitDie(older, olderTS, 0)
+    err := lm.AcquireWaitDie(younger, youngerTS, 0)
+    fmt.Println("Younger requesting older's page:", err)
+    if err == nil {
+        log.Fatal("younger requester did not die under wait-die")
+    }
+    lm.Release(older, 0)
+
+    // Older requests a page the younger transaction holds: it waits
+    lm.AcquireWaitDie(younger, youngerTS, 1)
+    done := make(chan error)
+    start := time.Now()
+    go func() {
+        done <- lm.AcquireWaitDie(older, olderTS, 1)
+    }()
+    time.Sleep(50 * time.Millisecond)
+    lm.Release(younger, 1)
+    err = <-done
+    fmt.Printf("Older requesting younger's page: %v after waiting %v\n", err, time.Since(start).Round(10*time.Millisecond))
+    if err != nil {
+        log.Fatal(err)
+    }
+}
+
+// AcquireWoundWait is the opposite timestamp policy to wait-die: an older
+// requester wounds a younger holder, telling it to abort, and takes the page
+// once the holder releases it, while a younger requester waits for an older
+// holder. A wounded transaction learns of it through Wounded, or from
+// ErrAbort if it is itself waiting for a lock.
+func (lm *LockManager) AcquireWoundWait(txID int, ts int64, pageIndex int) error {
+    lm.mu.Lock()
+    defer lm.mu.Unlock()
+
+    for {
+        if lm.isWounded(txID) {
+            delete(lm.waiting, txID)
+            return fmt.Errorf("tx %d wounded while waiting for page %d: %w", txID, pageIndex, ErrAbort)
+        }
+        holder, held := lm.holders[pageIndex]
+        if !held || holder == txID {
+            lm.holders[pageIndex] = txID
+            lm.holderTS[pageIndex] = ts
+            delete(lm.waiting, txID)
+            return nil
+        }
+        if ts < lm.holderTS[pageIndex] && !lm.isWounded(holder) {
+            close(lm.woundChan(holder))
+            lm.cond.Broadcast() // wake the holder if it is waiting on another page
+        }
+        lm.waiting[txID] = pageIndex
+        lm.cond.Wait()
+    }
+}
+
+// Wounded returns a channel that is closed when an older transaction wounds
+// txID; the transaction should then abort, releasing its locks.
+func (lm *LockManager) Wounded(txID int) <-chan struct{} {
+    lm.mu.Lock()
+    defer lm.mu.Unlock()
+    return lm.woundChan(txID)
+}
+
+// woundChan returns txID's wound channel, creating it if needed; the caller
+// must hold lm.mu.
+func (lm *LockManager) woundChan(txID int) chan struct{} {
+    c, ok := lm.wounds[txID]
+    if !ok {
+        c = make(chan struct{})
+        lm.wounds[txID] = c
+    }
+    return c
+}
+
+// isWounded reports whether txID has been wounded; the caller must hold lm.mu.
+func (lm *LockManager) isWounded(txID int) bool {
+    select {
+    case <-lm.woundChan(txID):
+        return true
+    default:
+        return false
+    }
+}
+
+func woundWaitExample() {
+    lm := NewLockManager()
+    const older, younger = 1, 2
+    const olderTS, youngerTS = 100, 200
+
+    // The younger transaction holds page 0 and aborts as soon as it is wounded
+    lm.AcquireWoundWait(younger, youngerTS, 0)
+    aborted := make(chan struct{})
+    go func() {
+        <-lm.Wounded(younger)
+        lm.Release(younger, 0)
+        close(aborted)
+    }()
+    err := lm.AcquireWoundWait(older, olderTS, 0)
+    <-aborted
+    fmt.Println("Older wounding younger holder:", err, "- holder is now tx", lm.holders[0])
+    if err != nil || lm.holders[0] != older {
+        log.Fatalf("older wounding younger holder returned %v, holder is tx %d", err, lm.holders[0])
+    }
+
+    // A younger requester waits for the older holder instead
+    other := 3
+    done := make(chan error)
+    start := time.Now()
+    go func() {
+        done <- lm.AcquireWoundWait(other, 300, 0)
+    }()
+    time.Sleep(50 * time.Millisecond)
+    lm.Release(older, 0)
+    err = <-done
+    fmt.Printf("Younger requesting older's page: %v after waiting %v\n", err, time.Since(start).Round(10*time.Millisecond))
+    if err != nil {
+        log.Fatal(err)
+    }
+}
+
+// victimPolicyExample builds the same deadlock under a policy and checks it
+// aborts want: tx 2 starts first and holds one page, tx 1 starts later and
+// holds two, and tx 2 closes the cycle.
+func victimPolicyExample(name string, policy VictimPolicy, want int) {
+    lm := NewLockManagerWithPolicy(policy)
+    lm.Acquire(2, 0)
+    lm.Acquire(1, 1)
+    lm.Acquire(1, 2)
+
+    tx1Done := make(chan error, 1)
+    go func() {
+        err := lm.Acquire(1, 0)
+        if err != nil {
+            lm.Release(1, 1)
+            lm.Release(1, 2)
+        }
+        tx1Done <- err
+    }()
+    for {
+        lm.mu.Lock()
+        _, blocked := lm.waiting[1]
+        lm.mu.Unlock()
+        if blocked {
+            break
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    var victim int
+    if err := lm.Acquire(2, 1); err != nil {
+        victim = 2
+        lm.Release(2, 0)
+        <-tx1Done
+    } else if err := <-tx1Done; err != nil {
+        victim = 1
+    }
+    fmt.Printf("%s policy aborts tx %d\n", name, victim)
+    if victim != want {
+        log.Fatalf("%s policy aborted tx %d, want tx %d", name, victim, want)
+    }
+}
+
+// multiPageStress has many goroutines update random pairs of pages, which
+// would deadlock with naive lock ordering, and reports whether they all
+// finished before the timeout.
+func multiPageStress(pf *PagedFile, goroutines, iterations int, timeout time.Duration) bool {
+    var wg sync.WaitGroup
+    wg.Add(goroutines)
+    for g := 0; g < goroutines; g++ {
+        go func(id int) {
+            defer wg.Done()
+            rng := rand.New(rand.NewSource(int64(id)))
+            for i := 0; i < iterations; i++ {
+                a, b := rng.Intn(pf.NumPages()), rng.Intn(pf.NumPages())
+                data := []byte(fmt.Sprintf("Writer %d pair %d", id, i))
+                pf.WriteMulti(map[int][]byte{a: data, b: data})
+            }
+        }(g)
+    }
+
+    done := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return true
+    case <-time.After(timeout):
+        return false
+    }
+}
+
+func fileBackedExample() {
+    dir, err := os.MkdirTemp("", "paged_file")
+    if err != nil {
+        fmt.Println("Error creating temp dir:", err)
+        return
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "pages.db")
+
+    pf, err := NewFileBackedPagedFile(path, PageSize, NumPages)
+    if err != nil {
+        fmt.Println("Error opening paged file:", err)
+        return
+    }
+    pf.Write(3, []byte("persisted page 3"))
+    pf.Close()
+
+    // Reopen and confirm the data survived
+    pf, err = NewFileBackedPagedFile(path, PageSize, NumPages)
+    if err != nil {
+        fmt.Println("Error reopening paged file:", err)
+        return
+    }
+    defer pf.Close()
+    data, _ := pf.Read(3)
+    fmt.Printf("After reopen, page 3 contains: %s\n", bytes.TrimRight(data, "\x00"))
+    if !bytes.HasPrefix(data, []byte("persisted page 3")) {
+        log.Fatal("page 3 did not survive a reopen")
+    }
+}
+
+// writerUnderReads keeps readers goroutines reading page 0 and reports how
+// many reads completed while a writer waited for the page.
+func writerUnderReads(pf *PagedFile, readers int) int64 {
+    stop := make(chan struct{})
+    var wg sync.WaitGroup
+    wg.Add(readers)
+    for i := 0; i < readers; i++ {
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-stop:
+                    return
+                default:
+                    pf.Read(0)
+                    runtime.Gosched() // stand-in for doing something with the page
+                }
+            }
+        }()
+    }
+    time.Sleep(10 * time.Millisecond) // let the readers get going
+
+    before := pf.Stats().Reads
+    pf.Write(0, []byte("writer got in"))
+    during := pf.Stats().Reads - before
+    close(stop)
+    wg.Wait()
+    return during
+}
+
+// writerPriorityExample checks that a writer under a steady stream of
+// readers only waits for the reads already in progress, plus at most one
+// more round as it releases the page, rather than being starved.
+func writerPriorityExample() {
+    const readers = 8
+    reads := writerUnderReads(NewPagedFileWithWriterPriority(PageSize, NumPages), readers)
+    fmt.Printf("WriterPriorityLock: writer got in after %d reads by %d readers\n", reads, readers)
+    if reads > 2*readers {
+        log.Fatalf("writer waited out %d reads; new readers were not held back", reads)
+    }
+}
+
+// doubleBufferExample has writers write unique payloads while a flusher
+// keeps calling SwapAndFlush, then decodes everything flushed and checks
+// each write appears exactly once.
+func doubleBufferExample() {
+    pf := NewPagedFile(PageSize, NumPages)
+    pf.BufferChanges()
+
+    var out bytes.Buffer
+    flushes, done := 0, make(chan struct{})
+    flusherDone := make(chan struct{})
+    go func() {
+        defer close(flusherDone)
+        for {
+            select {
+            case <-done:
+                return
+            default:
+            }
+            pf.SwapAndFlush(&out)
+            flushes++
+            runtime.Gosched()
+        }
+    }()
+
+    var wg sync.WaitGroup
+    wg.Add(8)
+    for g := 0; g < 8; g++ {
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 500; i++ {
+                pf.Write(i%NumPages, []byte(fmt.Sprintf("w%d-%d", g, i)))
+                runtime.Gosched() // let the flusher swap mid-stream, even on one CPU
+            }
+        }(g)
+    }
+    wg.Wait()
+    close(done)
+    <-flusherDone
+    pf.SwapAndFlush(&out) // whatever was written after the last periodic flush
+
+    seen := make(map[string]int)
+    data := out.Bytes()
+    for len(data) >= 8 {
+        n := binary.BigEndian.Uint32(data[4:8])
+        seen[string(data[8:8+n])]++
+        data = data[8+n:]
+    }
+    missing := 8*500 - len(seen)
+    duplicated := 0
+    for _, count := range seen {
+        if count > 1 {
+            duplicated++
+        }
+    }
+    fmt.Printf("Double buffer: %d periodic flushes, %d writes flushed, %d missing, %d duplicated\n",
+        flushes, len(seen), missing, duplicated)
+    if missing != 0 || duplicated != 0 {
+        log.Fatalf("double buffer lost %d writes and duplicated %d", missing, duplicated)
+    }
+}
+
+// statsExample makes a known number of concurrent reads and writes and
+// checks the counters add up exactly.
+func statsExample() {
+    pf := NewPagedFile(PageSize, NumPages)
+    var wg sync.WaitGroup
+    wg.Add(8)
+    for g := 0; g < 8; g++ {
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 100; i++ {
+                pf.Write(i%NumPages, []byte("twelve bytes"))
+                pf.Read(g % NumPages)
+                pf.Read(i % NumPages)
+            }
+        }(g)
+    }
+    wg.Wait()
+
+    stats := pf.Stats()
+    fmt.Printf("Stats: %d reads, %d writes, %d bytes written\n", stats.Reads, stats.Writes, stats.BytesWritten)
+    match := stats == PagedFileStats{Reads: 1600, Writes: 800, BytesWritten: 9600}
+    fmt.Println("Stats match 1600 reads, 800 writes, 9600 bytes:", match)
+    if !match {
+        log.Fatalf("stats are %+v", stats)
+    }
+}
+
+// WriteRecord is one write made by RunWriters.
+type WriteRecord struct {
+    Writer int
+    Page   int
+}
+
+// RunWriters starts numWriters goroutines that each write iterations times
+// to random pages of pf, and returns a record of every write that
+// succeeded. Writer i draws its pages from seed+i, so a fixed seed picks
+// the same pages every run, though the order of the records still depends
+// on scheduling.
+func RunWriters(pf *PagedFile, numWriters, iterations int, seed int64) []WriteRecord {
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    var records []WriteRecord
+
+    wg.Add(numWriters)
+    for i := 0; i < numWriters; i++ {
+        go func(id int) {
+            defer wg.Done()
+            rng := rand.New(rand.NewSource(seed + int64(id)))
+            for _, page := range writer(id, pf, rng, iterations) {
+                mu.Lock()
+                records = append(records, WriteRecord{Writer: id, Page: page})
+                mu.Unlock()
+            }
+        }(i)
+    }
+    wg.Wait()
+    return records
+}
+
+// pagesByWriter splits records into each writer's pages, in the order that
+// writer made them. Writers interleave differently from run to run, but each
+// one's own sequence depends only on the seed.
+func pagesByWriter(records []WriteRecord, numWriters int) [][]int {
+    pages := make([][]int, numWriters)
+    for _, r := range records {
+        pages[r.Writer] = append(pages[r.Writer], r.Page)
+    }
+    return pages
+}
+
+// writer makes iterations writes to random pages and returns the pages it
+// wrote.
+func writer(id int, pf *PagedFile, rng *rand.Rand, iterations int) []int {
+    var pages []int
+    for i := 0; i < iterations; i++ {
+        pageIndex := rng.Intn(pf.NumPages())
+        data := []byte(fmt.Sprintf("Writer %d writing to page %d", id, pageIndex))
+        if err := pf.Write(pageIndex, data); err != nil {
+            fmt.Printf("Writer %d failed: %v\n", id, err)
+            continue
+        }
+        fmt.Printf("Writer %d wrote to page %d\n", id, pageIndex)
+        pages = append(pages, pageIndex)
+        time.Sleep(100 * time.Millisecond)
+    }
+    return pages
+}
+
+// mixedThroughput has goroutines each perform opsPerGoroutine operations on
+// random pages, readPercent of them reads and the rest writes, and returns
+// operations per second. pf is created by the caller so setup stays out of
+// the timing.
+func mixedThroughput(pf *PagedFile, goroutines, opsPerGoroutine, readPercent int) float64 {
+    var wg sync.WaitGroup
+    start := time.Now()
+
+    wg.Add(goroutines)
+    for g := 0; g < goroutines; g++ {
+        go func(id int) {
+            defer wg.Done()
+            rng := rand.New(rand.NewSource(int64(id)))
+            data := []byte(fmt.Sprintf("Writer %d", id))
+            for i := 0; i < opsPerGoroutine; i++ {
+                pageIndex := rng.Intn(pf.NumPages())
+                if rng.Intn(100) < readPercent {
+                    pf.Read(pageIndex)
+                } else {
+                    pf.Write(pageIndex, data)
+                }
+            }
+        }(g)
+    }
+
+    wg.Wait()
+    return float64(goroutines*opsPerGoroutine) / time.Since(start).Seconds()
+}
+
+func geometryExample() {
+    // A tiny file: 4 pages of 16 bytes
+    pf := NewPagedFile(16, 4)
+    last := pf.NumPages() - 1
+    pf.Write(last, []byte("last page"))
+    data, _ := pf.Read(last)
+    fmt.Printf("Page %d of a %d-byte-page file contains: %s (%d bytes)\n", last, pf.PageSize(), bytes.TrimRight(data, "\x00"), len(data))
+    if len(data) != 16 {
+        log.Fatalf("read %d bytes from a 16-byte page", len(data))
+    }
+
+    if _, err := pf.Read(4); err != nil {
+        fmt.Println("Read(4):", err)
+    } else {
+        log.Fatal("Read(4) on a 4-page file succeeded")
+    }
+    if err := pf.Write(0, make([]byte, 17)); err != nil {
+        fmt.Println("Write(0, 17 bytes):", err)
+    } else {
+        log.Fatal("Write of 17 bytes to a 16-byte page succeeded")
+    }
+}
+
+func allocationExample() {
+    pf := NewPagedFile(16, 4)
+    for i := 0; i < pf.NumPages(); i++ {
+        pf.Allocate()
+    }
+    _, err := pf.Allocate()
+    fmt.Println("Allocate on a full file:", err)
+    if err == nil {
+        log.Fatal("Allocate on a full file succeeded")
+    }
+
+    pf.Free(2)
+    pageIndex, _ := pf.Allocate()
+    fmt.Println("Allocate after freeing page 2:", pageIndex)
+    if pageIndex != 2 {
+        log.Fatalf("Allocate after freeing page 2 returned page %d", pageIndex)
+    }
+    first, second := pf.Free(2), pf.Free(2)
+    fmt.Println("Freeing page 2 twice:", first, second)
+    if first != nil || second == nil {
+        log.Fatalf("want only the second Free to fail, got %v / %v", first, second)
+    }
+}
+
+func snapshotExample() {
+    pf := NewPagedFile(16, 4)
+    for i := 0; i < pf.NumPages(); i++ {
+        pf.Write(i, []byte(fmt.Sprintf("page %d v1", i)))
+    }
+
+    snap, _ := pf.Snapshot()
+    pf.Write(0, []byte("page 0 v2"))
+    pf.Write(2, []byte("page 2 v2"))
+
+    for i := 0; i < pf.NumPages(); i++ {
+        old, _ := snap.Read(i)
+        current, _ := pf.Read(i)
+        fmt.Printf("Page %d: snapshot %q, current %q\n", i, bytes.TrimRight(old, "\x00"), bytes.TrimRight(current, "\x00"))
+        if want := fmt.Sprintf("page %d v1", i); string(bytes.TrimRight(old, "\x00")) != want {
+            log.Fatalf("snapshot of page %d = %q, want %q", i, bytes.TrimRight(old, "\x00"), want)
+        }
+    }
+    snap.Release()
+}
+
+func main() {
+    pf := NewPagedFile(PageSize, NumPages)
+    records := RunWriters(pf, NumWriters, NumIterations, time.Now().UnixNano())
+    fmt.Println("Writes recorded:", len(records))
+    if len(records) != NumWriters*NumIterations {
+        log.Fatalf("%d writes recorded, want %d", len(records), NumWriters*NumIterations)
+    }
+
+    // Reading all pages
+    for i, page := range pf.pages {
+        data := page.data
+        fmt.Printf("Page %d contains: %s\n", i, string(data))
+    }
+
+    // Out-of-range pages and oversized data are rejected instead of panicking
+    if _, err := pf.Read(-1); err != nil {
+        fmt.Println("Read(-1):", err)
+    } else {
+        log.Fatal("Read(-1) succeeded")
+    }
+    if _, err := pf.Read(NumPages); err != nil {
+        fmt.Printf("Read(%d): %v\n", NumPages, err)
+    } else {
+        log.Fatalf("Read(%d) succeeded on a %d-page file", NumPages, NumPages)
+    }
+    if err := pf.Write(0, make([]byte, PageSize+1)); err != nil {
+        fmt.Println("Write(0, oversized):", err)
+    } else {
+        log.Fatal("Write of an oversized page succeeded")
+    }
+
+    // Only pages written since the last flush are flushed again
+    pf.Flush(io.Discard)
+    pf.Write(2, []byte("dirty"))
+    pf.Write(5, []byte("dirty"))
+    var out bytes.Buffer
+    flushed, _ := pf.Flush(&out)
+    fmt.Println("Flushed", flushed, "pages,", out.Len(), "bytes")
+    if flushed != 2 {
+        log.Fatalf("flushed %d pages, want the 2 dirty ones", flushed)
+    }
+    pf.Write(2, []byte("dirty again"))
+    flushed, _ = pf.Flush(&out)
+    fmt.Println("Flushed", flushed, "pages after rewriting page 2")
+    if flushed != 1 {
+        log.Fatalf("flushed %d pages after rewriting page 2, want 1", flushed)
+    }
+
+    // A small fixed run: every write is recorded and lands on a real page
+    small := RunWriters(NewPagedFile(PageSize, NumPages), 2, 3, 1)
+    valid := true
+    for _, r := range small {
+        valid = valid && r.Page >= 0 && r.Page < NumPages
+    }
+    fmt.Printf("RunWriters(2 writers, 3 iterations): %d writes, all pages valid: %v\n", len(small), valid)
+    if len(small) != 6 || !valid {
+        log.Fatalf("RunWriters recorded %d of 6 writes, all pages valid: %v", len(small), valid)
+    }
+
+    // The same seed reproduces the same pages for every writer
+    first := pagesByWriter(small, 2)
+    second := pagesByWriter(RunWriters(NewPagedFile(PageSize, NumPages), 2, 3, 1), 2)
+    fmt.Println("RunWriters pages per writer with seed 1:", first, "then", second)
+    for w := range first {
+        if !slices.Equal(first[w], second[w]) {
+            log.Fatalf("writer %d wrote pages %v, then %v with the same seed", w, first[w], second[w])
+        }
+    }
+
+    statsExample()
+    writerPriorityExample()
+    doubleBufferExample()
+    fileBackedExample()
+    geometryExample()
+    allocationExample()
+    snapshotExample()
+    completed := multiPageStress(NewPagedFile(PageSize, NumPages), 50, 200, 5*time.Second)
+    fmt.Println("Multi-page stress completed:", completed)
+    if !completed {
+        log.Fatal("multi-page stress did not complete; writers deadlocked")
+    }
+    lruExample()
+    bufferPoolExample()
+    deadlockDetectionExample()
+    victimPolicyExample("Youngest", YoungestPolicy{}, 1)
+    victimPolicyExample("Fewest locks", FewestLocksPolicy{}, 2)
+    waitDieExample()
+    woundWaitExample()
+    twoPhaseLockingExample()
+    savepointExample()
+    abortHookExample()
+
+    // Corrupt a page behind the PagedFile's back and let the checksum catch it
+    pf.pages[7].data[0] ^= 0xFF
+    ok, _ := pf.Verify(7)
+    fmt.Println("Page 7 checksum ok after corruption:", ok)
+    corrupted := pf.VerifyAll()
+    fmt.Println("Corrupted pages:", corrupted)
+    if ok || len(corrupted) != 1 || corrupted[0] != 7 {
+        log.Fatalf("checksum ok: %v, corrupted pages: %v; want only page 7 caught", ok, corrupted)
+    }
+
+    for _, readPercent := range []int{50, 95} {
+        opsPerSec := mixedThroughput(NewPagedFile(PageSize, NumPages), 32, 20000, readPercent)
+        fmt.Printf("Mixed throughput (%d%% reads, 32 goroutines): %.0f ops/sec\n", readPercent, opsPerSec)
     }
 }
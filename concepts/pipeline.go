@@ -0,0 +1,79 @@
+// Run with leakcheck.go: go run pipeline.go leakcheck.go
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+)
+
+// generate emits nums on its output channel. Like every stage, it closes its
+// output when it runs out of input or the context is cancelled, which tells
+// the next stage to finish too.
+func generate(ctx context.Context, nums []int) <-chan int {
+    out := make(chan int)
+    go func() {
+        defer close(out)
+        for _, n := range nums {
+            select {
+            case out <- n:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return out
+}
+
+func square(ctx context.Context, in <-chan int) <-chan int {
+    out := make(chan int)
+    go func() {
+        defer close(out)
+        for n := range in {
+            select {
+            case out <- n * n:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return out
+}
+
+// printAll is the final stage: it prints each value and returns them all
+// once its input is closed.
+func printAll(in <-chan int) []int {
+    var results []int
+    for n := range in {
+        fmt.Println(n)
+        results = append(results, n)
+    }
+    return results
+}
+
+func main() {
+    results := printAll(square(context.Background(), generate(context.Background(), []int{1, 2, 3, 4, 5})))
+    fmt.Println("Squares:", results)
+
+    // Cancel after the first value; every stage should shut down
+    err := checkNoLeaks(func() {
+        ctx, cancel := context.WithCancel(context.Background())
+        squares := square(ctx, generate(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+        fmt.Println("First square before cancelling:", <-squares)
+        cancel()
+        for range squares {
+            // Drain whatever was in flight when we cancelled
+        }
+    })
+    fmt.Println("Leak check after cancel:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    // Abandoning the pipeline without cancelling leaves the stages blocked on their sends
+    err = checkNoLeaks(func() {
+        squares := square(context.Background(), generate(context.Background(), []int{1, 2, 3}))
+        <-squares
+    })
+    fmt.Println("Leak check without cancel:", err)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+// Limiter is a token bucket: it holds up to burst tokens, refilled at rate
+// tokens per second, and each allowed request spends one. Tokens are
+// refilled lazily from the time elapsed since the last call, so no
+// background goroutine is needed.
+type Limiter struct {
+    rate   float64
+    burst  int
+    tokens float64
+    last   time.Time
+    mu     sync.Mutex
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+    return &Limiter{
+        rate:   rate,
+        burst:  burst,
+        tokens: float64(burst),
+        last:   time.Now(),
+    }
+}
+
+// refill adds the tokens earned since the last call; the caller must hold l.mu.
+func (l *Limiter) refill(now time.Time) {
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > float64(l.burst) {
+        l.tokens = float64(l.burst)
+    }
+    l.last = now
+}
+
+// Allow spends a token if one is available, without waiting.
+func (l *Limiter) Allow() bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    l.refill(time.Now())
+    if l.tokens < 1 {
+        return false
+    }
+    l.tokens--
+    return true
+}
+
+// Wait blocks until a token is available and spends it, or returns
+// ctx.Err() if the context is done first.
+func (l *Limiter) Wait(ctx context.Context) error {
+    for {
+        l.mu.Lock()
+        l.refill(time.Now())
+        if l.tokens >= 1 {
+            l.tokens--
+            l.mu.Unlock()
+            return nil
+        }
+        // Sleep until the missing fraction of a token has been earned
+        delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+        l.mu.Unlock()
+
+        timer := time.NewTimer(delay)
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        }
+    }
+}
+
+func main() {
+    // Call Allow about once a millisecond against 100 requests/sec with a burst of 10
+    limiter := NewLimiter(100, 10)
+    allowed, attempts := 0, 0
+    window := 500 * time.Millisecond
+    for start := time.Now(); time.Since(start) < window; attempts++ {
+        if limiter.Allow() {
+            allowed++
+        }
+        time.Sleep(time.Millisecond)
+    }
+    // The bucket can never hand out more than its burst plus what it earned
+    bound := 10 + int(100*window.Seconds())
+    fmt.Printf("Allowed %d of %d requests in %v (bound %d)\n", allowed, attempts, window, bound)
+    if allowed > bound {
+        log.Fatalf("allowed %d requests, more than the bound of %d", allowed, bound)
+    }
+
+    // Wait paces callers to the rate once the burst is spent
+    limiter = NewLimiter(50, 1)
+    start := time.Now()
+    for i := 0; i < 6; i++ {
+        limiter.Wait(context.Background())
+    }
+    elapsed := time.Since(start)
+    fmt.Printf("6 Waits at 50/sec with burst 1 took %v\n", elapsed.Round(10*time.Millisecond))
+    if elapsed < 5*time.Second/50 {
+        log.Fatalf("6 Waits took %v, faster than 5 refills at 50/sec", elapsed)
+    }
+
+    // A slow refill gives up at the context deadline
+    limiter = NewLimiter(1, 1)
+    limiter.Allow()
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    err := limiter.Wait(ctx)
+    fmt.Println("Wait with an empty bucket and a 50ms deadline:", err)
+    if err == nil {
+        log.Fatal("Wait with an empty bucket returned before the refill")
+    }
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+// RWLocker is the reader/writer lock interface both locks below implement.
+type RWLocker interface {
+    RLock()
+    RUnlock()
+    Lock()
+    Unlock()
+}
+
+// NaiveRWLock prefers readers: a reader gets in whenever no writer holds
+// the lock, even if a writer is waiting. As long as readers keep
+// overlapping, the count never drops to zero and the writer starves.
+type NaiveRWLock struct {
+    mu      sync.Mutex
+    cond    *sync.Cond
+    readers int
+    writer  bool
+}
+
+func NewNaiveRWLock() *NaiveRWLock {
+    l := &NaiveRWLock{}
+    l.cond = sync.NewCond(&l.mu)
+    return l
+}
+
+func (l *NaiveRWLock) RLock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    for l.writer {
+        l.cond.Wait()
+    }
+    l.readers++
+}
+
+func (l *NaiveRWLock) RUnlock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.readers--
+    if l.readers == 0 {
+        l.cond.Broadcast()
+    }
+}
+
+func (l *NaiveRWLock) Lock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    for l.writer || l.readers > 0 {
+        l.cond.Wait()
+    }
+    l.writer = true
+}
+
+func (l *NaiveRWLock) Unlock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.writer = false
+    l.cond.Broadcast()
+}
+
+// FairRWLock serves requests in arrival order. Each caller takes a ticket
+// and waits for its turn, so a reader that arrives after a waiting writer
+// queues behind it. Readers whose turns come up back to back still share
+// the lock.
+type FairRWLock struct {
+    mu         sync.Mutex
+    cond       *sync.Cond
+    nextTicket uint64 // handed to the next caller
+    serving    uint64 // the ticket whose turn it is
+    readers    int
+    writer     bool
+}
+
+func NewFairRWLock() *FairRWLock {
+    l := &FairRWLock{}
+    l.cond = sync.NewCond(&l.mu)
+    return l
+}
+
+func (l *FairRWLock) RLock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    ticket := l.nextTicket
+    l.nextTicket++
+    for ticket != l.serving || l.writer {
+        l.cond.Wait()
+    }
+    l.readers++
+    // Let the next ticket in; if it is another reader it can join this one
+    l.serving++
+    l.cond.Broadcast()
+}
+
+func (l *FairRWLock) RUnlock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.readers--
+    if l.readers == 0 {
+        l.cond.Broadcast()
+    }
+}
+
+func (l *FairRWLock) Lock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    ticket := l.nextTicket
+    l.nextTicket++
+    for ticket != l.serving || l.writer || l.readers > 0 {
+        l.cond.Wait()
+    }
+    l.writer = true
+    l.serving++
+}
+
+func (l *FairRWLock) Unlock() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.writer = false
+    l.cond.Broadcast()
+}
+
+// writerUnderReadLoad floods lock with readers that each hold it briefly
+// and immediately come back, then has one writer try to get in. It reports
+// how long the writer waited and whether it got the lock within window.
+func writerUnderReadLoad(lock RWLocker, readers int, window time.Duration) (time.Duration, bool) {
+    stop := make(chan struct{})
+    var wg sync.WaitGroup
+    wg.Add(readers)
+    for i := 0; i < readers; i++ {
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-stop:
+                    return
+                default:
+                }
+                lock.RLock()
+                time.Sleep(time.Millisecond)
+                lock.RUnlock()
+            }
+        }()
+        // Stagger the readers so their hold times overlap
+        time.Sleep(time.Millisecond / time.Duration(readers))
+    }
+
+    acquired := make(chan time.Duration, 1)
+    start := time.Now()
+    go func() {
+        lock.Lock()
+        acquired <- time.Since(start)
+        lock.Unlock()
+    }()
+
+    var waited time.Duration
+    ok := false
+    select {
+    case waited = <-acquired:
+        ok = true
+    case <-time.After(window):
+        waited = window
+    }
+    close(stop)
+    wg.Wait()
+    if !ok {
+        // With the readers gone the writer gets in; wait for it so it doesn't leak
+        <-acquired
+    }
+    return waited, ok
+}
+
+func main() {
+    window := 500 * time.Millisecond
+    for _, c := range []struct {
+        name string
+        lock RWLocker
+    }{
+        {"Naive (reader-preferring)", NewNaiveRWLock()},
+        {"Fair (FIFO)", NewFairRWLock()},
+    } {
+        waited, ok := writerUnderReadLoad(c.lock, 8, window)
+        fmt.Printf("%s: writer acquired within %v: %v (waited %v)\n", c.name, window, ok, waited.Round(time.Millisecond))
+        if _, fair := c.lock.(*FairRWLock); fair && !ok {
+            log.Fatalf("%s: writer starved for %v", c.name, window)
+        }
+    }
+}
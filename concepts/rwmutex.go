@@ -0,0 +1,91 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "time"
+)
+
+// SharedCounter lets any number of readers call Get at once; Inc takes the
+// lock exclusively.
+type SharedCounter struct {
+    value int64
+    lock  sync.RWMutex
+}
+
+func (c *SharedCounter) Inc() {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.value++
+}
+
+func (c *SharedCounter) Get() int64 {
+    c.lock.RLock()
+    defer c.lock.RUnlock()
+    return c.value
+}
+
+// MutexCounter is the same counter with a plain mutex, so readers serialize too.
+type MutexCounter struct {
+    value int64
+    lock  sync.Mutex
+}
+
+func (c *MutexCounter) Inc() {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    c.value++
+}
+
+func (c *MutexCounter) Get() int64 {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    return c.value
+}
+
+type counter interface {
+    Inc()
+    Get() int64
+}
+
+// runWorkload has each goroutine do opsPerGoroutine operations, one in ten
+// of them an Inc and the rest Gets. Returns the elapsed time and the number
+// of Inc calls made.
+func runWorkload(c counter, goroutines, opsPerGoroutine int) (time.Duration, int64) {
+    elapsed := timeGoroutines(goroutines, func(int) {
+        for i := 0; i < opsPerGoroutine; i++ {
+            if i%10 == 0 {
+                c.Inc()
+            } else {
+                c.Get()
+            }
+        }
+    })
+    incs := int64(goroutines * ((opsPerGoroutine + 9) / 10))
+    return elapsed, incs
+}
+
+func main() {
+    goroutines := 32
+    opsPerGoroutine := 100000
+
+    rw := &SharedCounter{}
+    rwTime, incs := runWorkload(rw, goroutines, opsPerGoroutine)
+    fmt.Println("RWMutex final value:", rw.Get(), "expected:", incs)
+    if rw.Get() != incs {
+        log.Fatalf("RWMutex final value %d, expected %d", rw.Get(), incs)
+    }
+
+    mu := &MutexCounter{}
+    muTime, incs := runWorkload(mu, goroutines, opsPerGoroutine)
+    fmt.Println("Mutex final value:", mu.Get(), "expected:", incs)
+    if mu.Get() != incs {
+        log.Fatalf("Mutex final value %d, expected %d", mu.Get(), incs)
+    }
+
+    total := float64(goroutines * opsPerGoroutine)
+    fmt.Printf("90%% reads: RWMutex %.1f ns/op, Mutex %.1f ns/op\n",
+        float64(rwTime.Nanoseconds())/total,
+        float64(muTime.Nanoseconds())/total)
+}
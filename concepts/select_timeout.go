@@ -0,0 +1,100 @@
+// Run with leakcheck.go: go run select_timeout.go leakcheck.go
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+)
+
+var ErrTimeout = errors.New("timed out waiting for result")
+
+// fetchWithTimeout runs work on its own goroutine and returns its result,
+// or ErrTimeout if d passes first. work can't be interrupted, so on a
+// timeout it keeps running; the result channel has room for one value, so
+// its goroutine can still send and exit instead of blocking forever.
+func fetchWithTimeout(d time.Duration, work func() int) (int, error) {
+    result := make(chan int, 1)
+    go func() { result <- work() }()
+
+    select {
+    case v := <-result:
+        return v, nil
+    case <-time.After(d):
+        return 0, ErrTimeout
+    }
+}
+
+// fetchWithContext is fetchWithTimeout for a caller that already has a
+// deadline or a cancel: it gives up with ctx.Err() when ctx is done.
+func fetchWithContext(ctx context.Context, work func() int) (int, error) {
+    result := make(chan int, 1)
+    go func() { result <- work() }()
+
+    select {
+    case v := <-result:
+        return v, nil
+    case <-ctx.Done():
+        return 0, ctx.Err()
+    }
+}
+
+// fetchLeaky is fetchWithTimeout with an unbuffered result channel. After a
+// timeout nobody ever receives, so the work goroutine blocks on its send
+// for the rest of the program.
+func fetchLeaky(d time.Duration, work func() int) (int, error) {
+    result := make(chan int)
+    go func() { result <- work() }()
+
+    select {
+    case v := <-result:
+        return v, nil
+    case <-time.After(d):
+        return 0, ErrTimeout
+    }
+}
+
+func slowWork(d time.Duration, v int) func() int {
+    return func() int {
+        time.Sleep(d)
+        return v
+    }
+}
+
+func main() {
+    v, err := fetchWithTimeout(100*time.Millisecond, slowWork(10*time.Millisecond, 42))
+    fmt.Println("Fast work:", v, err)
+    if v != 42 || err != nil {
+        log.Fatalf("fast work returned %d, %v; want 42", v, err)
+    }
+    v, err = fetchWithTimeout(10*time.Millisecond, slowWork(50*time.Millisecond, 42))
+    fmt.Println("Slow work:", v, err)
+    if err == nil {
+        log.Fatal("slow work did not time out")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+    v, err = fetchWithContext(ctx, slowWork(50*time.Millisecond, 42))
+    fmt.Println("Slow work with a context deadline:", v, err)
+    if !errors.Is(err, context.DeadlineExceeded) {
+        log.Fatalf("slow work with a context deadline returned %v, want %v", err, context.DeadlineExceeded)
+    }
+
+    // Let the slow work above finish so it doesn't skew the goroutine counts
+    time.Sleep(50 * time.Millisecond)
+
+    // The slow work outlives the timeout but still exits once it's done
+    err = checkNoLeaks(func() {
+        fetchWithTimeout(10*time.Millisecond, slowWork(50*time.Millisecond, 42))
+    })
+    fmt.Println("Leak check after a timeout:", err)
+    if err != nil {
+        log.Fatal(err)
+    }
+    fmt.Println("Leak check with an unbuffered result channel:", checkNoLeaks(func() {
+        fetchLeaky(10*time.Millisecond, slowWork(50*time.Millisecond, 42))
+    }))
+}
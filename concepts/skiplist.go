@@ -0,0 +1,204 @@
+package main
+
+// skiplist.go has no main of its own; it holds the memtable's keys. Run
+// them together: go run memtable.go skiplist.go log_segment.go
+
+import (
+    "fmt"
+    "log"
+    "math/rand"
+    "sort"
+    "sync"
+)
+
+const (
+    skipListMaxLevel = 16
+    skipListP        = 0.5 // chance a node reaching level i also reaches i+1
+)
+
+type skipNode struct {
+    key, value int
+    next       []*skipNode // next[i] is the following node on level i
+}
+
+// SkipList is a sorted linked list with express lanes: every node is on
+// level 0, and each level above holds a random subset of about half the
+// nodes below it. A search runs along the highest level until the next key
+// would overshoot, then drops a level, so it takes O(log n) steps on
+// average without any rebalancing. Memtables in LSM stores are often skip
+// lists. A single RWMutex keeps it safe for concurrent use.
+type SkipList struct {
+    head  skipNode // sentinel with a next pointer for every level
+    level int      // levels currently in use
+    rng   *rand.Rand
+    count int
+    mu    sync.RWMutex
+}
+
+func NewSkipList(seed int64) *SkipList {
+    return &SkipList{
+        head:  skipNode{next: make([]*skipNode, skipListMaxLevel)},
+        level: 1,
+        rng:   rand.New(rand.NewSource(seed)),
+    }
+}
+
+// randomLevel flips coins: level 1 always, each further level with
+// probability skipListP. The caller must hold s.mu for writing.
+func (s *SkipList) randomLevel() int {
+    level := 1
+    for level < skipListMaxLevel && s.rng.Float64() < skipListP {
+        level++
+    }
+    return level
+}
+
+// Insert adds key, or updates its value if it is already present.
+func (s *SkipList) Insert(key, value int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.insertLocked(key, value, s.randomLevel())
+}
+
+// insertLocked inserts key with a node of the given height, which lets the
+// example build a tall node on purpose; the caller must hold s.mu for
+// writing.
+func (s *SkipList) insertLocked(key, value, level int) {
+    // update[i] is the last node on level i before key
+    var update [skipListMaxLevel]*skipNode
+    n := &s.head
+    for i := s.level - 1; i >= 0; i-- {
+        for n.next[i] != nil && n.next[i].key < key {
+            n = n.next[i]
+        }
+        update[i] = n
+    }
+    if next := n.next[0]; next != nil && next.key == key {
+        next.value = value
+        return
+    }
+
+    for i := s.level; i < level; i++ {
+        update[i] = &s.head
+    }
+    s.level = max(s.level, level)
+
+    node := &skipNode{key: key, value: value, next: make([]*skipNode, level)}
+    for i := 0; i < level; i++ {
+        node.next[i] = update[i].next[i]
+        update[i].next[i] = node
+    }
+    s.count++
+}
+
+func (s *SkipList) Search(key int) (int, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    n := &s.head
+    for i := s.level - 1; i >= 0; i-- {
+        for n.next[i] != nil && n.next[i].key < key {
+            n = n.next[i]
+        }
+    }
+    if next := n.next[0]; next != nil && next.key == key {
+        return next.value, true
+    }
+    return 0, false
+}
+
+// Range returns every key in [lo, hi] in ascending order. It descends to
+// the first key >= lo like a search, then walks level 0.
+func (s *SkipList) Range(lo, hi int) []int {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    n := &s.head
+    for i := s.level - 1; i >= 0; i-- {
+        for n.next[i] != nil && n.next[i].key < lo {
+            n = n.next[i]
+        }
+    }
+    var keys []int
+    for n = n.next[0]; n != nil && n.key <= hi; n = n.next[0] {
+        keys = append(keys, n.key)
+    }
+    return keys
+}
+
+// Each calls fn for every entry in ascending key order.
+func (s *SkipList) Each(fn func(key, value int)) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    for n := s.head.next[0]; n != nil; n = n.next[0] {
+        fn(n.key, n.value)
+    }
+}
+
+func (s *SkipList) Len() int {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.count
+}
+
+func skipListExample() {
+    list := NewSkipList(1)
+
+    // Out-of-order inserts come back sorted
+    rng := rand.New(rand.NewSource(2))
+    keys := rng.Perm(1000)
+    for _, key := range keys {
+        list.Insert(key, key*10)
+    }
+    all := list.Range(0, 999)
+    fmt.Println("Range sorted:", sort.IntsAreSorted(all), "- keys:", len(all), "- levels in use:", list.level)
+    fmt.Println("Range(10, 15):", list.Range(10, 15))
+    if !sort.IntsAreSorted(all) || len(all) != len(keys) {
+        log.Fatalf("Range returned %d keys out of order, want %d sorted", len(all), len(keys))
+    }
+
+    value, ok := list.Search(42)
+    fmt.Printf("Search 42 = %d (found: %v)\n", value, ok)
+    if !ok || value != 420 {
+        log.Fatalf("Search 42 = %d (found: %v), want 420", value, ok)
+    }
+    _, ok = list.Search(5000)
+    fmt.Println("Search 5000 found:", ok)
+    if ok {
+        log.Fatal("found key 5000, which was never inserted")
+    }
+
+    // A node forced onto every level is reachable from the top lane
+    tall := NewSkipList(1)
+    for _, key := range []int{5, 1, 9} {
+        tall.Insert(key, key)
+    }
+    tall.mu.Lock()
+    tall.insertLocked(7, 70, skipListMaxLevel)
+    tall.mu.Unlock()
+    value, ok = tall.Search(7)
+    fmt.Printf("Forced %d-level node: Search 7 = %d (found: %v), head's top lane points at %d, Range = %v\n",
+        skipListMaxLevel, value, ok, tall.head.next[skipListMaxLevel-1].key, tall.Range(0, 10))
+    if !ok || value != 70 {
+        log.Fatalf("forced node: Search 7 = %d (found: %v), want 70", value, ok)
+    }
+
+    // Concurrent inserts and reads; run with -race to check the locking
+    var wg sync.WaitGroup
+    concurrent := NewSkipList(3)
+    for g := 0; g < 8; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 500; i++ {
+                concurrent.Insert(g*500+i, i)
+                concurrent.Search(i)
+            }
+        }(g)
+    }
+    wg.Wait()
+    fmt.Println("Keys after concurrent inserts:", concurrent.Len())
+    if concurrent.Len() != 8*500 {
+        log.Fatalf("%d keys after concurrent inserts, want %d", concurrent.Len(), 8*500)
+    }
+}
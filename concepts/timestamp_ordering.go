@@ -0,0 +1,113 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "sync/atomic"
+)
+
+var ErrAbort = errors.New("transaction aborted: operation arrived too late")
+
+// toItem records, for one key, the newest timestamps that read and wrote it.
+type toItem struct {
+    value   int
+    readTS  uint64
+    writeTS uint64
+}
+
+// TOStore schedules operations by timestamp ordering: transactions are
+// ordered by their start timestamp, and any operation that would break that
+// order is rejected instead of waiting for a lock.
+type TOStore struct {
+    items map[string]*toItem
+    clock uint64
+    mu    sync.Mutex
+}
+
+func NewTOStore() *TOStore {
+    return &TOStore{items: make(map[string]*toItem)}
+}
+
+// Begin returns a new transaction's timestamp, larger than every earlier one.
+func (s *TOStore) Begin() uint64 {
+    return atomic.AddUint64(&s.clock, 1)
+}
+
+func (s *TOStore) item(key string) *toItem {
+    it, ok := s.items[key]
+    if !ok {
+        it = &toItem{}
+        s.items[key] = it
+    }
+    return it
+}
+
+// Read returns key's value for the transaction at txTS, or ErrAbort if a
+// younger transaction has already overwritten it.
+func (s *TOStore) Read(txTS uint64, key string) (int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    it := s.item(key)
+    if txTS < it.writeTS {
+        return 0, ErrAbort
+    }
+    if txTS > it.readTS {
+        it.readTS = txTS
+    }
+    return it.value, nil
+}
+
+// Write sets key for the transaction at txTS. It returns ErrAbort if a
+// younger transaction has already read the old value. A write older than
+// the current one is obsolete, so under the Thomas Write Rule it is
+// skipped instead of aborting.
+func (s *TOStore) Write(txTS uint64, key string, value int) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    it := s.item(key)
+    if txTS < it.readTS {
+        return ErrAbort
+    }
+    if txTS < it.writeTS {
+        return nil
+    }
+    it.value = value
+    it.writeTS = txTS
+    return nil
+}
+
+func main() {
+    store := NewTOStore()
+
+    // A late read: t1 starts first, but t2 writes x before t1 reads it
+    t1, t2 := store.Begin(), store.Begin()
+    store.Write(t2, "x", 20)
+    _, err := store.Read(t1, "x")
+    fmt.Println("t1 reads x after t2 wrote it:", err)
+    if !errors.Is(err, ErrAbort) {
+        log.Fatalf("late read returned %v, want %v", err, ErrAbort)
+    }
+
+    // A late write after a younger read aborts
+    t3, t4 := store.Begin(), store.Begin()
+    store.Read(t4, "y")
+    err = store.Write(t3, "y", 30)
+    fmt.Println("t3 writes y after t4 read it:", err)
+    if !errors.Is(err, ErrAbort) {
+        log.Fatalf("late write returned %v, want %v", err, ErrAbort)
+    }
+
+    // Thomas Write Rule: an obsolete write is skipped, not aborted
+    t5, t6 := store.Begin(), store.Begin()
+    store.Write(t6, "z", 60)
+    err = store.Write(t5, "z", 50)
+    value, _ := store.Read(store.Begin(), "z")
+    fmt.Printf("t5 writes z after t6 did: err = %v, z = %d\n", err, value)
+    if err != nil || value != 60 {
+        log.Fatalf("obsolete write returned %v and left z = %d, want nil and 60", err, value)
+    }
+}
@@ -0,0 +1,28 @@
+package main
+
+// timing.go has no main of its own; run it alongside the counter benchmarks
+// that use it, e.g. go run mutex.go timing.go
+
+import (
+    "sync"
+    "time"
+)
+
+// timeGoroutines starts numGoroutines goroutines, each calling work with its
+// own id from 0 to numGoroutines-1, and returns how long it took for all of
+// them to finish.
+func timeGoroutines(numGoroutines int, work func(id int)) time.Duration {
+    var wg sync.WaitGroup
+    start := time.Now()
+
+    wg.Add(numGoroutines)
+    for i := 0; i < numGoroutines; i++ {
+        go func(id int) {
+            defer wg.Done()
+            work(id)
+        }(i)
+    }
+
+    wg.Wait()
+    return time.Since(start)
+}
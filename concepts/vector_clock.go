@@ -0,0 +1,220 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// VectorClock counts, for each node, how many events that node has
+// recorded. One clock happens before another if it is no larger in every
+// entry and smaller in at least one; a missing node counts as zero.
+type VectorClock map[int]uint64
+
+// Ordering is how two vector clocks relate.
+type Ordering int
+
+const (
+    Equal Ordering = iota
+    HappensBefore
+    HappensAfter
+    Concurrent // neither saw the other: each has an event the other lacks
+)
+
+func (o Ordering) String() string {
+    switch o {
+    case Equal:
+        return "equal"
+    case HappensBefore:
+        return "happens-before"
+    case HappensAfter:
+        return "happens-after"
+    default:
+        return "concurrent"
+    }
+}
+
+// Increment records a new event on node.
+func (vc VectorClock) Increment(node int) {
+    vc[node]++
+}
+
+// Merge raises every entry to at least other's, so vc has seen everything
+// either clock had.
+func (vc VectorClock) Merge(other VectorClock) {
+    for node, count := range other {
+        if count > vc[node] {
+            vc[node] = count
+        }
+    }
+}
+
+// Compare reports how vc is ordered relative to other.
+func (vc VectorClock) Compare(other VectorClock) Ordering {
+    less, greater := false, false
+    for node, count := range vc {
+        if count > other[node] {
+            greater = true
+        } else if count < other[node] {
+            less = true
+        }
+    }
+    for node, count := range other {
+        if _, ok := vc[node]; !ok && count > 0 {
+            less = true
+        }
+    }
+
+    switch {
+    case less && greater:
+        return Concurrent
+    case less:
+        return HappensBefore
+    case greater:
+        return HappensAfter
+    default:
+        return Equal
+    }
+}
+
+func (vc VectorClock) Copy() VectorClock {
+    c := make(VectorClock, len(vc))
+    for node, count := range vc {
+        c[node] = count
+    }
+    return c
+}
+
+// String lists the entries in node order, e.g. {1:2 2:1}.
+func (vc VectorClock) String() string {
+    nodes := make([]int, 0, len(vc))
+    for node := range vc {
+        nodes = append(nodes, node)
+    }
+    sort.Ints(nodes)
+    parts := make([]string, len(nodes))
+    for i, node := range nodes {
+        parts[i] = fmt.Sprintf("%d:%d", node, vc[node])
+    }
+    return "{" + strings.Join(parts, " ") + "}"
+}
+
+// Sibling is one version of a key together with the clock it was written at.
+type Sibling struct {
+    Value string
+    Clock VectorClock
+}
+
+// VCStore keeps multiple versions of a key the way a Dynamo-style store
+// does. Unlike the MVCC store, there is no single commit order: a write
+// replaces only the versions its clock has seen, and versions written
+// concurrently on different nodes are all kept as siblings for the next
+// reader to reconcile.
+type VCStore struct {
+    versions map[string][]Sibling
+    events   VectorClock // the last event each node has recorded
+    mu       sync.Mutex
+}
+
+func NewVCStore() *VCStore {
+    return &VCStore{versions: make(map[string][]Sibling), events: VectorClock{}}
+}
+
+// Get returns every current sibling of key and a context clock that merges
+// all of them. Passing that context to Put marks the write as having seen,
+// and so replacing, every sibling returned.
+func (s *VCStore) Get(key string) ([]Sibling, VectorClock) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    context := VectorClock{}
+    siblings := make([]Sibling, len(s.versions[key]))
+    for i, v := range s.versions[key] {
+        siblings[i] = Sibling{Value: v.Value, Clock: v.Clock.Copy()}
+        context.Merge(v.Clock)
+    }
+    return siblings, context
+}
+
+// Put writes value on node, given the context clock of the versions the
+// writer read. Versions that happen before the new clock are replaced;
+// concurrent ones stay as siblings. Returns the new version's clock.
+func (s *VCStore) Put(key, value string, context VectorClock, node int) VectorClock {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    // The write is node's next event, even if the context is stale and
+    // doesn't include node's latest ones
+    s.events.Increment(node)
+    clock := context.Copy()
+    clock[node] = s.events[node]
+
+    var kept []Sibling
+    for _, v := range s.versions[key] {
+        if v.Clock.Compare(clock) == Concurrent {
+            kept = append(kept, v)
+        }
+    }
+    s.versions[key] = append(kept, Sibling{Value: value, Clock: clock})
+    return clock
+}
+
+func main() {
+    // The three ways two clocks can be ordered
+    a := VectorClock{1: 1}
+    b := a.Copy()
+    b.Increment(1)
+    c := a.Copy()
+    c.Increment(2)
+    fmt.Printf("%v vs %v: %v\n", a, b, a.Compare(b))
+    fmt.Printf("%v vs %v: %v\n", b, a, b.Compare(a))
+    fmt.Printf("%v vs %v: %v\n", b, c, b.Compare(c))
+    if a.Compare(b) != HappensBefore || b.Compare(a) != HappensAfter || b.Compare(c) != Concurrent {
+        log.Fatal("clocks compared in the wrong order")
+    }
+
+    merged := b.Copy()
+    merged.Merge(c)
+    after := merged.Compare(b) == HappensAfter && merged.Compare(c) == HappensAfter
+    fmt.Printf("%v merged with %v = %v, which happens after both: %v\n", b, c, merged, after)
+    if !after {
+        log.Fatalf("merged clock %v does not happen after both inputs", merged)
+    }
+
+    store := NewVCStore()
+    store.Put("cart", "milk", VectorClock{}, 1)
+
+    // Two clients read the same version, then write through different nodes
+    _, context := store.Get("cart")
+    store.Put("cart", "milk, eggs", context, 1)
+    store.Put("cart", "milk, bread", context, 2)
+    siblings, context := store.Get("cart")
+    fmt.Println("Siblings after concurrent writes:")
+    for _, s := range siblings {
+        fmt.Printf("  %q at %v\n", s.Value, s.Clock)
+    }
+    if len(siblings) != 2 {
+        log.Fatalf("%d siblings after concurrent writes, want 2", len(siblings))
+    }
+
+    // A client that read both siblings writes the merge, replacing them
+    store.Put("cart", "milk, eggs, bread", context, 1)
+    siblings, _ = store.Get("cart")
+    fmt.Printf("After reconciling: %d sibling(s), %q at %v\n", len(siblings), siblings[0].Value, siblings[0].Clock)
+    if len(siblings) != 1 {
+        log.Fatalf("%d siblings after reconciling, want 1", len(siblings))
+    }
+
+    // A write from a stale context is concurrent with the current version, not newer
+    store.Put("cart", "milk, jam", VectorClock{1: 1}, 2)
+    siblings, _ = store.Get("cart")
+    fmt.Println("Siblings after a write from a stale context:")
+    for _, s := range siblings {
+        fmt.Printf("  %q at %v\n", s.Value, s.Clock)
+    }
+    if len(siblings) != 2 {
+        log.Fatalf("%d siblings after a write from a stale context, want 2", len(siblings))
+    }
+}
@@ -0,0 +1,87 @@
+// Run with leakcheck.go: go run worker_pool.go leakcheck.go
+package main
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "sync"
+    "sync/atomic"
+)
+
+var ErrPoolClosed = errors.New("pool is closed")
+
+// Pool fans submitted tasks out to a fixed number of worker goroutines
+// through a buffered jobs channel.
+type Pool struct {
+    jobs   chan func()
+    wg     sync.WaitGroup
+    lock   sync.RWMutex // Submit holds it shared, Wait exclusively, so no send races the close
+    closed bool
+}
+
+func NewPool(workers int) *Pool {
+    p := &Pool{jobs: make(chan func(), workers*2)}
+    p.wg.Add(workers)
+    for i := 0; i < workers; i++ {
+        go func() {
+            defer p.wg.Done()
+            for task := range p.jobs {
+                task()
+            }
+        }()
+    }
+    return p
+}
+
+// Submit queues task, blocking while the queue is full. It returns
+// ErrPoolClosed once Wait has been called.
+func (p *Pool) Submit(task func()) error {
+    p.lock.RLock()
+    defer p.lock.RUnlock()
+
+    if p.closed {
+        return ErrPoolClosed
+    }
+    p.jobs <- task
+    return nil
+}
+
+// Wait stops accepting tasks and blocks until every submitted task has run.
+func (p *Pool) Wait() {
+    p.lock.Lock()
+    if !p.closed {
+        p.closed = true
+        close(p.jobs)
+    }
+    p.lock.Unlock()
+
+    p.wg.Wait()
+}
+
+func main() {
+    var counter int64
+    var pool *Pool
+
+    // Wait must stop every worker, not just drain the queue
+    leakErr := checkNoLeaks(func() {
+        pool = NewPool(8)
+        for i := 0; i < 1000; i++ {
+            pool.Submit(func() {
+                atomic.AddInt64(&counter, 1)
+            })
+        }
+        pool.Wait()
+    })
+    fmt.Println("Final Counter:", counter)
+    fmt.Println("Leak check after Wait:", leakErr)
+    if counter != 1000 || leakErr != nil {
+        log.Fatalf("ran %d of 1000 tasks, leak check: %v", counter, leakErr)
+    }
+
+    err := pool.Submit(func() {})
+    fmt.Println("Submit after Wait:", err)
+    if err == nil {
+        log.Fatal("Submit after Wait was accepted")
+    }
+}
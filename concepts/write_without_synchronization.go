@@ -2,7 +2,10 @@ package main
 
 import (
     "fmt"
+    "log"
     "os"
+    "path/filepath"
+    "strings"
     "sync"
 )
 
@@ -25,19 +28,82 @@ func writeToFile(filename, content string, wg *sync.WaitGroup) {
     }
 }
 
-func main() {
-    var wg sync.WaitGroup
-    filename := "test.txt"
+// writeWithSynchronization appends instead of truncating, and holds mu for
+// each write so lines from different goroutines never interleave mid-line.
+func writeWithSynchronization(filename, content string, mu *sync.Mutex, wg *sync.WaitGroup) {
+    defer wg.Done()
 
+    file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+    if err != nil {
+        fmt.Println("Error opening file:", err)
+        return
+    }
+    defer file.Close()
+
+    for i := 0; i < 5; i++ {
+        mu.Lock()
+        _, err := file.WriteString(content)
+        mu.Unlock()
+        if err != nil {
+            fmt.Println("Error writing to file:", err)
+            return
+        }
+    }
+}
+
+// unsynchronizedWrites races two truncating writers on filename and returns
+// what ends up in the file; each writer's O_TRUNC can wipe the other's lines.
+func unsynchronizedWrites(filename string) (string, error) {
+    var wg sync.WaitGroup
     wg.Add(2)
     go writeToFile(filename, "AAAAA\n", &wg)
     go writeToFile(filename, "BBBBB\n", &wg)
     wg.Wait()
 
     data, err := os.ReadFile(filename)
+    return string(data), err
+}
+
+// synchronizedWrites runs the same two writers with writeWithSynchronization;
+// the file always ends up holding five of each line.
+func synchronizedWrites(filename string) (string, error) {
+    if err := os.WriteFile(filename, nil, 0644); err != nil {
+        return "", err
+    }
+
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go writeWithSynchronization(filename, "AAAAA\n", &mu, &wg)
+    go writeWithSynchronization(filename, "BBBBB\n", &mu, &wg)
+    wg.Wait()
+
+    data, err := os.ReadFile(filename)
+    return string(data), err
+}
+
+func main() {
+    dir, err := os.MkdirTemp("", "write_sync")
+    if err != nil {
+        fmt.Println("Error creating temp dir:", err)
+        return
+    }
+    defer os.RemoveAll(dir)
+
+    data, err := unsynchronizedWrites(filepath.Join(dir, "unsynchronized.txt"))
+    if err != nil {
+        fmt.Println("Error reading file:", err)
+        return
+    }
+    fmt.Println("File Content without synchronization:\n", data)
+
+    data, err = synchronizedWrites(filepath.Join(dir, "synchronized.txt"))
     if err != nil {
         fmt.Println("Error reading file:", err)
         return
     }
-    fmt.Println("File Content:\n", string(data))
+    fmt.Println("File Content with synchronization:\n", data)
+    if strings.Count(data, "AAAAA\n") != 5 || strings.Count(data, "BBBBB\n") != 5 {
+        log.Fatal("synchronized writes did not leave five of each line")
+    }
 }
@@ -2,11 +2,15 @@ package main
 
 import "fmt"
 
-func main() {
+func pingPong() string {
   messages := make(chan string)
-  go func() { message <- "ping" }()
+  go func() { messages <- "ping" }()
   msg := <- messages
-  fmt.Println(msg)
+  return msg
+}
+
+func main() {
+  fmt.Println(pingPong())
 }
 
 /*
@@ -2,7 +2,7 @@ package main
 
 import (
   "fmt"
-  "time"
+  "sync"
 )
 
 /*
@@ -10,22 +10,39 @@ When we run this program, we see the output of the `blocking` call first, then t
 The goroutines' output may be interleaved, because goroutines are being run concurrently by the Go runtime.
 */
 
-func f (from string) {
+func f (from string, wg *sync.WaitGroup) {
+  defer wg.Done()
   for i := 0; i < 3; i++ {
     fmt.Println(from, ":", i)
   }
 }
 
+// collectF returns the lines f would print, so the result can be checked without racing on stdout.
+func collectF(from string) []string {
+  var lines []string
+  for i := 0; i < 3; i++ {
+    lines = append(lines, fmt.Sprintf("%s : %d", from, i))
+  }
+  return lines
+}
+
 func main() {
-  f("direct")
-  go f("goroutine")
+  var wg sync.WaitGroup
+  wg.Add(3)
+
+  f("direct", &wg)
+  go f("goroutine", &wg)
 
   go func(msg string) {
+    defer wg.Done()
     fmt.Println(msg)
   }("going")
 
-  time.Sleep(time.Second)
+  // Wait for both goroutines instead of sleeping and hoping they finished
+  wg.Wait()
   fmt.Println("done")
+
+  fmt.Println(len(collectF("collected")), "lines collected")
 }
 
 /*
@@ -37,4 +54,5 @@ going
 goroutine : 1
 goroutine : 2
 done
+3 lines collected
 */